@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/wselwood/gompcreader"
+)
+
+/*
+AstorbReader reads the fixed width astorb.dat format from any stream.
+See http://www.naic.edu/~nolan/astorb.html for the layout.
+*/
+type AstorbReader struct {
+	lineReader
+}
+
+/*
+NewAstorbReader opens the path given (or stdin for "-") and returns a reader for the records in it.
+*/
+func NewAstorbReader(path string) (*AstorbReader, error) {
+	input, err := OpenInput(path)
+	if err != nil {
+		return nil, err
+	}
+	result := newAstorbReader(input)
+	result.name = path
+	return result, nil
+}
+
+func newAstorbReader(input io.ReadCloser) *AstorbReader {
+	return &AstorbReader{newLineReader(input, "astorb")}
+}
+
+/*
+Next returns the next record, or io.EOF when there are no more.
+*/
+func (reader *AstorbReader) Next() (*gompcreader.MinorPlanet, error) {
+	var result *gompcreader.MinorPlanet
+	err := reader.read(func(line string) (err error) {
+		result, err = parseAstorbLine(line)
+		return err
+	})
+	return result, err
+}
+
+/*
+parseAstorbLine converts a single line of astorb.dat. The number, or the preliminary designation for
+unnumbered objects, is packed the same way as MPCORB so the two catalogues can be merged. astorb only gives
+the length of the observed arc so the first and last observation years are left empty. The IRAS diameter,
+ephemeris uncertainty and orbit computation date columns have nowhere to go in the record so are not read.
+*/
+func parseAstorbLine(line string) (*gompcreader.MinorPlanet, error) {
+	if len(line) < 181 {
+		return nil, fmt.Errorf("line too short, %d characters", len(line))
+	}
+
+	var result gompcreader.MinorPlanet
+	fields := fieldReader{line: line}
+
+	result.ReadableDesignation = fields.str(8, 25)
+	result.ID = fields.str(1, 6)
+	if result.ID == "" {
+		result.ID = result.ReadableDesignation
+	}
+	if result.ID == "" {
+		return nil, fmt.Errorf("missing designation")
+	}
+	result.ID = packDesignation(result.ID)
+	result.ComputerName = fields.str(27, 41)
+	result.AbsoluteMagnitude = fields.unknownFloat("absolute magnitude", 43, 47)
+	result.Slope = fields.optionalFloat("slope", 49, 53)
+	result.ArcLength = fields.optionalInt("arc length", 96, 100)
+	result.NumberOfObservations = fields.optionalInt("number of observations", 102, 105)
+	result.Epoch = fields.date("epoch", 107, 114)
+	result.MeanAnomalyEpoch = fields.float("mean anomaly", 116, 125)
+	result.ArgumentOfPerihelion = fields.float("argument of perihelion", 127, 136)
+	result.LongitudeOfTheAscendingNode = fields.float("longitude of the ascending node", 138, 147)
+	result.InclinationToTheEcliptic = fields.float("inclination", 149, 157)
+	result.OrbitalEccentricity = fields.float("eccentricity", 159, 168)
+	result.SemimajorAxis = fields.float("semimajor axis", 170, 181)
+
+	if fields.err != nil {
+		return nil, fields.err
+	}
+	return &result, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const ceresAstorbLine = "     1 Ceres              E. Bowell        3.34  0.12 0.72 848.4 G       0   0   0   0   0   0 79117 1021 20201217 162.686310  73.731610  80.286980 10.588620 0.07755710   2.76765690 20201214    0.01     0.00 20201217"
+
+func TestParseAstorbLine(t *testing.T) {
+	result, err := parseAstorbLine(ceresAstorbLine)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "00001", result.ID, "numbers are packed like MPCORB")
+	assert.Equal(t, "Ceres", result.ReadableDesignation)
+	assert.Equal(t, 3.34, result.AbsoluteMagnitude)
+	assert.Equal(t, int64(79117), result.ArcLength)
+	assert.Equal(t, int64(1021), result.NumberOfObservations)
+	assert.Equal(t, time.Date(2020, time.December, 17, 0, 0, 0, 0, time.UTC), result.Epoch)
+	assert.Equal(t, 10.58862, result.InclinationToTheEcliptic)
+	assert.Equal(t, 0.0775571, result.OrbitalEccentricity)
+	assert.Equal(t, 2.7676569, result.SemimajorAxis)
+}
+
+func TestParseAstorbLineUnnumbered(t *testing.T) {
+	result, err := parseAstorbLine("       2004 MN4          " + ceresAstorbLine[25:])
+	assert.NoError(t, err)
+	assert.Equal(t, "K04M04N", result.ID, "designations are packed like MPCORB")
+	assert.Equal(t, "2004 MN4", result.ReadableDesignation)
+}
+
+func TestAstorbReader(t *testing.T) {
+	reader := newAstorbReader(ioutil.NopCloser(strings.NewReader(ceresAstorbLine + "\n\n" + ceresAstorbLine[:100] + "\n")))
+
+	result, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "00001", result.ID)
+
+	_, err = reader.Next()
+	assert.Error(t, err, "short line")
+
+	_, err = reader.Next()
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/wselwood/gompcreader"
+)
+
+/*
+AutoRangeOptions control how ranges are picked from the data. Sample is the number of records to look at,
+zero for all of them, they are picked at random from the whole input as the files are sorted. Clip is the percentage of values ignored at each end so a few odd objects do not
+stretch the grid, and Bins is the number of cells to aim for. QuantileClip is the same for quantile edges,
+it is normally zero so every object lands in a cell. Ranges turns on picking ranges for the numeric
+dimensions and Quantile switches all of them to quantile binning.
+*/
+type AutoRangeOptions struct {
+	Sample       int64
+	Clip         float64
+	QuantileClip float64
+	Bins         int
+	Ranges       bool
+	Quantile     bool
+}
+
+/*
+AutoRange reads records from the source and gives each numeric dimension a range that fits them. Dimensions
+with quantile binning always get their edges worked out here. Dimensions without a Value, like the
+categories and angles, and dimensions with extra buckets, like the comet aphelion, are left as they are. Whole number dimensions, like the years, and month dimensions
+are not clipped at the top so the newest objects always fit. Records that fail to parse are skipped, they
+are reported when the grids are built.
+*/
+func AutoRange(source RecordSource, dimensions []Dimension, options AutoRangeOptions) ([]Dimension, error) {
+	if options.Clip < 0 || options.Clip >= 50 {
+		return nil, fmt.Errorf("auto range clip %v must be between 0 and 50 percent", options.Clip)
+	}
+	if options.QuantileClip < 0 || options.QuantileClip >= 50 {
+		return nil, fmt.Errorf("quantile clip %v must be between 0 and 50 percent", options.QuantileClip)
+	}
+	if options.Bins < 1 || options.Bins > maxGridSize {
+		return nil, fmt.Errorf("auto range bins %d must be between 1 and %d", options.Bins, maxGridSize)
+	}
+
+	values := make([][]float64, len(dimensions))
+	fractional := make([]bool, len(dimensions))
+	add := func(record *gompcreader.MinorPlanet) {
+		for i, dimension := range dimensions {
+			if dimension.Value == nil || len(dimension.Buckets) > 0 {
+				continue
+			}
+			value := dimension.Value(record)
+			if math.IsNaN(value) || math.IsInf(value, 0) || (dimension.Scale == "log" && value <= 0) {
+				continue
+			}
+			values[i] = append(values[i], value)
+			fractional[i] = fractional[i] || value != math.Trunc(value)
+		}
+	}
+
+	// reservoir sampling, fixed seed so the same input always gives the same ranges
+	random := rand.New(rand.NewSource(1))
+	var sample []*gompcreader.MinorPlanet
+	var count int64
+	for {
+		record, err := source.Next()
+		if err == io.EOF {
+			break
+		} else if _, ok := err.(*ParseError); ok {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		count = count + 1
+
+		if options.Sample == 0 {
+			add(record)
+		} else if count <= options.Sample {
+			sample = append(sample, record)
+		} else if slot := random.Int63n(count); slot < options.Sample {
+			sample[slot] = record
+		}
+	}
+	for _, record := range sample {
+		add(record)
+	}
+
+	result := make([]Dimension, len(dimensions))
+	for i, dimension := range dimensions {
+		result[i] = dimension
+		if dimension.Value == nil || len(dimension.Buckets) > 0 {
+			continue
+		}
+		quantile := dimension.Scale == "quantile" || options.Quantile
+		if len(values[i]) == 0 {
+			if dimension.Scale == "quantile" {
+				return nil, fmt.Errorf("no values in the input to work out the quantiles of %s", dimension.Name)
+			}
+			continue
+		}
+		sort.Float64s(values[i])
+		clip := options.Clip
+		if quantile {
+			clip = options.QuantileClip
+		}
+		low := percentile(values[i], clip)
+		high := percentile(values[i], 100-clip)
+		if !fractional[i] || dimension.Scale == "month" {
+			high = values[i][len(values[i])-1]
+		}
+		if quantile {
+			bins := options.Bins
+			if dimension.Scale == "quantile" {
+				bins = dimension.GridSize
+			}
+			result[i] = quantileRange(dimension, clipped(values[i], low, high), bins)
+		} else if !options.Ranges {
+			continue
+		} else if dimension.Scale == "log" {
+			result[i] = logRange(dimension, low, high, options.Bins)
+		} else if dimension.Scale == "month" {
+			result[i] = monthRange(dimension, low, high)
+		} else {
+			result[i] = linearRange(dimension, low, high, options.Bins, !fractional[i])
+		}
+	}
+	return result, nil
+}
+
+/*
+percentile picks the value p percent of the way through sorted values.
+*/
+func percentile(sorted []float64, p float64) float64 {
+	index := int(math.Floor(p / 100 * float64(len(sorted)-1)))
+	return sorted[index]
+}
+
+/*
+niceStep rounds a step size to 1, 2 or 5 times a power of ten so the cell edges are easy to read.
+*/
+func niceStep(raw float64) float64 {
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, nice := range []float64{1, 2, 5} {
+		if raw <= nice*magnitude*1.5 {
+			return nice * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+/*
+linearRange picks equal sized cells. Whole number values, like years, never get cells smaller than one.
+*/
+func linearRange(dimension Dimension, low float64, high float64, bins int, whole bool) Dimension {
+	step := 1.0
+	if high > low {
+		step = niceStep((high - low) / float64(bins))
+	}
+	if whole && step < 1 {
+		step = 1
+	}
+	minValue := round(math.Floor(low/step)*step, 9)
+	// the top value gets a cell of its own rather than sitting on the edge of the grid
+	maxValue := round((math.Floor(high/step)+1)*step, 9)
+	if maxValue <= minValue {
+		maxValue = minValue + step
+	}
+	grid := int(math.Ceil((maxValue-minValue)/step - 1e-9))
+	if grid > maxGridSize {
+		grid = maxGridSize
+		maxValue = minValue + step*float64(grid)
+	}
+
+	dimension.MinValue = minValue
+	dimension.MaxValue = maxValue
+	dimension.GridSize = grid
+	dimension.StepSize = step
+	dimension.AutoRanged = true
+	dimension.Extractor = &LinearExtractor{dimension.Value, minValue, maxValue, grid, step}
+	return dimension
+}
+
+/*
+logRange covers whole decades with at most ten cells in each, like the built in log dimensions.
+*/
+func logRange(dimension Dimension, low float64, high float64, bins int) Dimension {
+	minDecade := math.Floor(math.Log10(low))
+	maxDecade := math.Ceil(math.Log10(high))
+	if maxDecade <= minDecade {
+		maxDecade = minDecade + 1
+	}
+	decades := int(maxDecade - minDecade)
+	perDecade := int(math.Max(1, math.Min(10, math.Floor(float64(bins)/float64(decades)+0.5))))
+
+	var format func(float64) string
+	if existing, ok := dimension.Extractor.(*LogExtractor); ok {
+		format = existing.format
+	}
+
+	dimension.MinValue = math.Pow(10, minDecade)
+	dimension.MaxValue = math.Pow(10, maxDecade)
+	dimension.GridSize = decades * perDecade
+	dimension.StepSize = 1 / float64(perDecade)
+	dimension.AutoRanged = true
+	dimension.Extractor = &LogExtractor{dimension.Value, dimension.MinValue, dimension.MaxValue, int32(dimension.GridSize), format}
+	return dimension
+}
+
+/*
+monthRange covers the whole years from low to high, keeping a cell for each month. The bins setting is
+not used as merging months would hide the seasons.
+*/
+func monthRange(dimension Dimension, low float64, high float64) Dimension {
+	minYear := math.Floor(low)
+	maxYear := math.Floor(high) + 1
+	if (maxYear-minYear)*12 > maxGridSize {
+		// keep the latest years
+		minYear = maxYear - math.Floor(maxGridSize/12)
+	}
+
+	dimension.MinValue = minYear
+	dimension.MaxValue = maxYear
+	dimension.GridSize = int(maxYear-minYear) * 12
+	dimension.StepSize = 1.0 / 12
+	dimension.AutoRanged = true
+	dimension.Extractor = &MonthExtractor{dimension.Value, minYear, int32(dimension.GridSize)}
+	return dimension
+}
+
+func clipped(sorted []float64, low float64, high float64) []float64 {
+	start := sort.SearchFloat64s(sorted, low)
+	end := sort.Search(len(sorted), func(i int) bool { return sorted[i] > high })
+	return sorted[start:end]
+}
+
+/*
+quantileEdges splits sorted values into bins holding about the same number of values each. Repeated values
+can not be split so there may be fewer bins than asked for. The last edge is the largest value.
+*/
+func quantileEdges(sorted []float64, bins int) []float64 {
+	edges := []float64{sorted[0]}
+	for k := 1; k < bins; k++ {
+		edge := sorted[k*len(sorted)/bins]
+		if edge > edges[len(edges)-1] {
+			edges = append(edges, edge)
+		}
+	}
+	if last := sorted[len(sorted)-1]; last > edges[len(edges)-1] || len(edges) == 1 {
+		edges = append(edges, last)
+	}
+	return edges
+}
+
+/*
+quantileRange gives the dimension cells holding about the same number of objects each. StepSize is the
+average cell width, the viewer uses the edges to draw the real widths.
+*/
+func quantileRange(dimension Dimension, sorted []float64, bins int) Dimension {
+	edges := quantileEdges(sorted, bins)
+	if edges[len(edges)-1] <= edges[0] {
+		// every value is the same, give it a cell of its own
+		edges[len(edges)-1] = edges[0] + 1
+	}
+
+	var format func(float64) string
+	switch existing := dimension.Extractor.(type) {
+	case *LogExtractor:
+		format = existing.format
+	case *QuantileExtractor:
+		format = existing.format
+	case *MonthExtractor:
+		format = formatMonth
+	}
+
+	dimension.Edges = edges
+	dimension.MinValue = edges[0]
+	dimension.MaxValue = edges[len(edges)-1]
+	dimension.GridSize = len(edges) - 1
+	dimension.StepSize = (dimension.MaxValue - dimension.MinValue) / float64(dimension.GridSize)
+	dimension.Scale = "quantile"
+	dimension.AutoRanged = true
+	dimension.Extractor = &QuantileExtractor{dimension.Value, edges, format}
+	return dimension
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wselwood/gompcreader"
+)
+
+func TestNiceStep(t *testing.T) {
+	cases := []struct {
+		in  float64
+		out float64
+	}{
+		{1, 1},
+		{1.4, 1},
+		{2.25, 2},
+		{4, 5},
+		{0.07, 0.05},
+		{80, 100},
+	}
+	for _, tt := range cases {
+		assert.InDelta(t, tt.out, niceStep(tt.in), 1e-12, "step for %f", tt.in)
+	}
+}
+
+func TestAutoRange(t *testing.T) {
+	var records []*gompcreader.MinorPlanet
+	for year := 1801; year <= 2024; year++ {
+		record := planet("x", 2020, int64(year-1790))
+		record.YearOfFirstObservation = int64(year)
+		record.SemimajorAxis = 2 + float64(year-1801)/10
+		record.OrbitalEccentricity = 0.1
+		records = append(records, record)
+	}
+
+	dimensions := []Dimension{buildYearOfFirstObs(), buildSemiMajorAxis(), buildNumberOfObservations(), buildOrbitClass()}
+	var options AutoRangeOptions
+	options.Bins = 100
+	options.Ranges = true
+	ranged, err := AutoRange(NewSliceSource("test", records), dimensions, options)
+	assert.NoError(t, err)
+
+	years := ranged[0]
+	assert.True(t, years.AutoRanged)
+	assert.Equal(t, 1800.0, years.MinValue)
+	assert.Equal(t, 2026.0, years.MaxValue)
+	assert.Equal(t, 2.0, years.StepSize)
+	assert.Equal(t, 113, years.GridSize)
+	recent := planet("y", 2020, 1)
+	recent.YearOfFirstObservation = 2024
+	assert.Equal(t, int32(112), years.Extractor.ExtractCell(recent))
+
+	axis := ranged[1]
+	assert.Equal(t, 2.0, axis.MinValue)
+	assert.Equal(t, 24.4, axis.MaxValue)
+
+	observations := ranged[2]
+	assert.Equal(t, 10.0, observations.MinValue)
+	assert.Equal(t, 1000.0, observations.MaxValue)
+	assert.Equal(t, 20, observations.GridSize)
+
+	assert.False(t, ranged[3].AutoRanged)
+	assert.Equal(t, dimensions[3].GridSize, ranged[3].GridSize)
+}
+
+func TestAutoRangeClip(t *testing.T) {
+	var records []*gompcreader.MinorPlanet
+	for i := 0; i < 1000; i++ {
+		record := planet("x", 2020, 1)
+		record.SemimajorAxis = 2 + float64(i)/1000
+		records = append(records, record)
+	}
+	records[999].SemimajorAxis = 500
+
+	var options AutoRangeOptions
+	options.Bins = 10
+	options.Ranges = true
+	options.Clip = 0.5
+	ranged, err := AutoRange(NewSliceSource("test", records), []Dimension{buildSemiMajorAxis()}, options)
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, ranged[0].MinValue)
+	assert.Equal(t, 3.0, ranged[0].MaxValue)
+
+	var recent []*gompcreader.MinorPlanet
+	for year := 2000; year < 2025; year++ {
+		record := planet("x", 2020, 1)
+		record.YearOfFirstObservation = int64(year)
+		recent = append(recent, record)
+	}
+	ranged, err = AutoRange(NewSliceSource("test", recent), []Dimension{buildYearOfFirstObs()}, options)
+	assert.NoError(t, err)
+	assert.Equal(t, 2026.0, ranged[0].MaxValue, "the newest year is not clipped")
+
+	options.Clip = 0
+	ranged, err = AutoRange(NewSliceSource("test", recent), []Dimension{buildYearOfFirstObs()}, options)
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, ranged[0].StepSize)
+
+	options.Bins = 100
+	ranged, err = AutoRange(NewSliceSource("test", recent), []Dimension{buildYearOfFirstObs()}, options)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, ranged[0].StepSize, "years are never split")
+	assert.Equal(t, 25, ranged[0].GridSize)
+
+	options.Clip = 50
+	_, err = AutoRange(NewSliceSource("test", records), []Dimension{buildSemiMajorAxis()}, options)
+	assert.Error(t, err)
+}
+
+func TestAutoRangeSample(t *testing.T) {
+	var records []*gompcreader.MinorPlanet
+	for i := 0; i < 1000; i++ {
+		record := planet("x", 2020, 1)
+		record.SemimajorAxis = 2 + float64(i)/100
+		records = append(records, record)
+	}
+
+	var options AutoRangeOptions
+	options.Bins = 10
+	options.Ranges = true
+	options.Sample = 100
+	ranged, err := AutoRange(NewSliceSource("test", records), []Dimension{buildSemiMajorAxis()}, options)
+	assert.NoError(t, err)
+	assert.True(t, ranged[0].MaxValue > 10, "the sample is taken from the whole input, not the first records")
+}
+
+func TestQuantileEdges(t *testing.T) {
+	cases := []struct {
+		in   []float64
+		bins int
+		out  []float64
+	}{
+		{[]float64{1, 2, 3, 4, 5, 6, 7, 8}, 4, []float64{1, 3, 5, 7, 8}},
+		{[]float64{1, 1, 1, 1, 2, 3}, 3, []float64{1, 2, 3}},
+		{[]float64{4, 4, 4}, 2, []float64{4, 4}},
+	}
+	for _, tt := range cases {
+		assert.Equal(t, tt.out, quantileEdges(tt.in, tt.bins), "edges for %v", tt.in)
+	}
+}
+
+func TestAutoRangeQuantile(t *testing.T) {
+	var records []*gompcreader.MinorPlanet
+	for i := 0; i < 100; i++ {
+		record := planet("x", 2020, 1)
+		record.SemimajorAxis = float64(i * i)
+		records = append(records, record)
+	}
+
+	config := DimensionConfig{Name: "Axis", Field: "semimajor-axis", Grid: 4, Binning: "quantile"}
+	configured, err := BuildConfiguredDimensions([]DimensionConfig{config}, DefaultAlbedo())
+	assert.NoError(t, err)
+	dimensions := append(configured, buildSemiMajorAxis())
+
+	var options AutoRangeOptions
+	options.Bins = 10
+	ranged, err := AutoRange(NewSliceSource("test", records), dimensions, options)
+	assert.NoError(t, err)
+
+	axis := ranged[0]
+	assert.Equal(t, "quantile", axis.Scale)
+	assert.Equal(t, []float64{0, 625, 2500, 5625, 9801}, axis.Edges)
+	assert.Equal(t, 4, axis.GridSize)
+	counts := make([]int, axis.GridSize)
+	for _, record := range records {
+		counts[axis.Extractor.ExtractCell(record)]++
+	}
+	assert.Equal(t, []int{25, 25, 25, 25}, counts)
+	assert.Equal(t, "625", axis.Extractor.Extract(records[30]))
+
+	// the range clip does not push objects out of the quantile cells
+	options.Clip = 5
+	clippedRanges, err := AutoRange(NewSliceSource("test", records), dimensions, options)
+	assert.NoError(t, err)
+	assert.Equal(t, axis.Edges, clippedRanges[0].Edges)
+	options.QuantileClip = 5
+	clippedRanges, err = AutoRange(NewSliceSource("test", records), dimensions, options)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(-1), clippedRanges[0].Extractor.ExtractCell(records[0]), "clipped when asked for")
+	options.Clip = 0
+	options.QuantileClip = 0
+
+	// the standard dimension is only changed when asked for
+	assert.Empty(t, ranged[1].Edges)
+	options.Quantile = true
+	ranged, err = AutoRange(NewSliceSource("test", records), dimensions, options)
+	assert.NoError(t, err)
+	assert.Len(t, ranged[1].Edges, 11)
+}
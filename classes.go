@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/wselwood/gompcreader"
+)
+
+/*
+orbitClasses are the dynamical classes objects are sorted into, in the order of their cells.
+Anything that does not fit one of them is "other".
+*/
+var orbitClasses = []string{"atira", "aten", "apollo", "amor", "mba", "hilda", "trojan", "centaur", "tno", "other"}
+
+/*
+orbitClass sorts an orbit into one of the orbitClasses using the usual boundaries on a, q and Q.
+The near earth classes are checked first so a high eccentricity orbit with a main belt a is still an Apollo or Amor.
+*/
+func orbitClass(in *gompcreader.MinorPlanet) string {
+	a := in.SemimajorAxis
+	e := in.OrbitalEccentricity
+	if a <= 0 || e >= 1 {
+		return "other"
+	}
+	q := a * (1 - e)
+	Q := a * (1 + e)
+
+	switch {
+	case a < 1 && Q < 0.983:
+		return "atira"
+	case a < 1:
+		return "aten"
+	case q < 1.017:
+		return "apollo"
+	case q < 1.3:
+		return "amor"
+	case a >= 2.0 && a < 3.3 && q >= 1.666:
+		return "mba"
+	case a >= 3.7 && a < 4.2 && e < 0.3:
+		return "hilda"
+	case a >= 5.05 && a < 5.35 && e < 0.3:
+		return "trojan"
+	case a >= 5.5 && a < 30.1:
+		return "centaur"
+	case a >= 30.1:
+		return "tno"
+	}
+	return "other"
+}
+
+var orbitClassField = categoricalField{
+	orbitClasses,
+	orbitClass,
+	"Dynamical class from a, q and Q. Atira Q < 0.983, Aten a < 1, Apollo q < 1.017, Amor q < 1.3, " +
+		"mba 2.0 <= a < 3.3 with q >= 1.666, hilda 3.7 <= a < 4.2, trojan 5.05 <= a < 5.35, centaur 5.5 <= a < 30.1, tno a >= 30.1",
+}
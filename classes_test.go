@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wselwood/gompcreader"
+)
+
+type orbitClassTestCase struct {
+	name                  string
+	inSemimajorAxis       float64
+	inOrbitalEccentricity float64
+	out                   string
+}
+
+var orbitClassTestCases = []orbitClassTestCase{
+	{"Ayló'chaxnim", 0.555, 0.177, "atira"},
+	{"Apophis", 0.922, 0.191, "aten"},
+	{"Bennu", 1.126, 0.204, "apollo"},
+	{"Eros", 1.458, 0.223, "amor"},
+	{"Ceres", 2.768, 0.078, "mba"},
+	{"Hilda", 3.97, 0.14, "hilda"},
+	{"Hektor", 5.26, 0.02, "trojan"},
+	{"Chiron", 13.7, 0.38, "centaur"},
+	{"Arrokoth", 44.6, 0.04, "tno"},
+	{"Mars crosser", 1.9, 0.2, "other"},
+	{"Hyperbolic", -1.2, 3.4, "other"},
+}
+
+func TestOrbitClass(t *testing.T) {
+	extractor := buildOrbitClass().Extractor
+	for _, tt := range orbitClassTestCases {
+		var input gompcreader.MinorPlanet
+		input.SemimajorAxis = tt.inSemimajorAxis
+		input.OrbitalEccentricity = tt.inOrbitalEccentricity
+
+		assert.Equal(t, tt.out, orbitClass(&input), tt.name)
+		assert.Equal(t, tt.out, extractor.Extract(&input), tt.name)
+		assert.Equal(t, orbitClasses[extractor.ExtractCell(&input)], tt.out, tt.name)
+	}
+}
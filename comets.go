@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/wselwood/gompcreader"
+)
+
+/*
+CometReader reads the MPC comet orbit file, CometEls.txt.
+See http://www.minorplanetcenter.net/iau/info/CometOrbitFormat.html for the layout.
+
+Comets only give the perihelion distance q, so the semi-major axis is derived as q/(1-e). This is negative
+for hyperbolic orbits, the same as the SBDB gives it. Parabolic orbits have no semi-major axis so q is kept
+in SemimajorAxis for them, use perihelionDistance, aphelionDistance and semimajorAxis rather than working
+the distances out from the fields.
+*/
+type CometReader struct {
+	lineReader
+}
+
+/*
+NewCometReader opens the path given (or stdin for "-") and returns a reader for the comets in it.
+*/
+func NewCometReader(path string) (*CometReader, error) {
+	input, err := OpenInput(path)
+	if err != nil {
+		return nil, err
+	}
+	result := newCometReader(input)
+	result.name = path
+	return result, nil
+}
+
+func newCometReader(input io.ReadCloser) *CometReader {
+	return &CometReader{newLineReader(input, "comet")}
+}
+
+/*
+Next returns the next comet, or io.EOF when there are no more.
+*/
+func (reader *CometReader) Next() (*gompcreader.MinorPlanet, error) {
+	var result *gompcreader.MinorPlanet
+	err := reader.read(func(line string) (err error) {
+		result, err = parseCometLine(line)
+		return err
+	})
+	return result, err
+}
+
+func parseCometLine(line string) (*gompcreader.MinorPlanet, error) {
+	if len(line) < 103 {
+		return nil, fmt.Errorf("line too short, %d characters", len(line))
+	}
+
+	var result gompcreader.MinorPlanet
+	fields := fieldReader{line: line}
+
+	result.ReadableDesignation = fields.str(103, 158)
+	if fields.str(1, 4) != "" {
+		result.ID = fmt.Sprintf("%d%s", fields.int("periodic comet number", 1, 4), fields.str(5, 5))
+		// fragments of a numbered comet carry their letter in the designation columns, e.g. 73P-B
+		if fragment := fields.str(6, 12); len(fragment) == 1 {
+			result.ID = result.ID + "-" + strings.ToUpper(fragment)
+		} else if fragment != "" {
+			result.ID = result.ID + "-" + fragment
+		}
+	} else {
+		result.ID = strings.TrimSpace(strings.Split(result.ReadableDesignation, "(")[0])
+	}
+	if result.ID == "" {
+		return nil, fmt.Errorf("missing designation")
+	}
+
+	perihelion := fields.float("perihelion distance", 31, 39)
+	result.OrbitalEccentricity = fields.float("eccentricity", 42, 49)
+	result.ArgumentOfPerihelion = fields.float("argument of perihelion", 52, 59)
+	result.LongitudeOfTheAscendingNode = fields.float("longitude of the ascending node", 62, 69)
+	result.InclinationToTheEcliptic = fields.float("inclination", 72, 79)
+	result.Epoch = fields.optionalDate("epoch", 82, 89)
+	result.AbsoluteMagnitude = fields.unknownFloat("absolute magnitude", 92, 95)
+	result.Slope = fields.optionalFloat("slope", 97, 100)
+	result.Reference = fields.str(160, 168)
+
+	if fields.err != nil {
+		return nil, fields.err
+	}
+
+	if result.OrbitalEccentricity == 1 {
+		result.SemimajorAxis = perihelion
+	} else {
+		result.SemimajorAxis = perihelion / (1 - result.OrbitalEccentricity)
+	}
+	return &result, nil
+}
+
+/*
+perihelionDistance works out q for any orbit, including the parabolic and hyperbolic comets.
+*/
+func perihelionDistance(in *gompcreader.MinorPlanet) float64 {
+	if in.OrbitalEccentricity == 1 {
+		return in.SemimajorAxis
+	}
+	return in.SemimajorAxis * (1 - in.OrbitalEccentricity)
+}
+
+/*
+aphelionDistance works out Q, orbits with e >= 1 have none.
+*/
+func aphelionDistance(in *gompcreader.MinorPlanet) float64 {
+	if in.OrbitalEccentricity >= 1 {
+		return math.NaN()
+	}
+	return in.SemimajorAxis * (1 + in.OrbitalEccentricity)
+}
+
+/*
+semimajorAxis is a, parabolic orbits have none.
+*/
+func semimajorAxis(in *gompcreader.MinorPlanet) float64 {
+	if in.OrbitalEccentricity == 1 {
+		return math.NaN()
+	}
+	return in.SemimajorAxis
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wselwood/gompcreader"
+)
+
+const halleyLine = "0001P         1986 02  5.4986  0.574580  0.967942  112.2520   59.6052  162.1860  20220915   4.0  6.0  1P/Halley                                                 98, 1083"
+const borisovLine = "    CK19Q040  2019 12  8.5546  2.006548  3.356633  209.1251  308.1480   44.0526  20191223  12.8  4.0  C/2019 Q4 (Borisov)                                      MPEC 2020"
+
+func TestParseCometLine(t *testing.T) {
+	halley, err := parseCometLine(halleyLine)
+	assert.NoError(t, err)
+	assert.Equal(t, "1P", halley.ID)
+	assert.Equal(t, "1P/Halley", halley.ReadableDesignation)
+	assert.Equal(t, 0.967942, halley.OrbitalEccentricity)
+	assert.Equal(t, 162.186, halley.InclinationToTheEcliptic)
+	assert.InDelta(t, 0.57458, perihelionDistance(halley), 0.000001)
+
+	borisov, err := parseCometLine(borisovLine)
+	assert.NoError(t, err)
+	assert.Equal(t, "C/2019 Q4", borisov.ID)
+	assert.InDelta(t, 2.006548/(1-3.356633), borisov.SemimajorAxis, 0.000001, "hyperbolic orbits have a negative semi-major axis")
+	assert.InDelta(t, 2.006548, perihelionDistance(borisov), 0.000001)
+	assert.InDelta(t, 2.006548, dimensionFields["perihelion"](borisov), 0.000001)
+	assert.True(t, math.IsNaN(aphelionDistance(borisov)), "hyperbolic orbits have no aphelion")
+
+	// q comes from the record itself, not from anything read before
+	var other gompcreader.MinorPlanet
+	other.ID = borisov.ID
+	other.OrbitalEccentricity = borisov.OrbitalEccentricity
+	assert.Equal(t, 0.0, perihelionDistance(&other))
+}
+
+func TestParseCometLineFragments(t *testing.T) {
+	line := "0073P      b  2022 08 25.8868  0.922604  0.685638  199.3108   69.5856   11.2303  20220930  11.7  6.0  73P-B/Schwassmann-Wachmann                               MPC107687"
+	fragmentB, err := parseCometLine(line)
+	assert.NoError(t, err)
+	assert.Equal(t, "73P-B", fragmentB.ID)
+
+	fragmentC, err := parseCometLine(strings.Replace(line, "      b  ", "      c  ", 1))
+	assert.NoError(t, err)
+	assert.Equal(t, "73P-C", fragmentC.ID, "each fragment is its own object")
+}
+
+func TestParseCometLineParabolic(t *testing.T) {
+	parabolic, err := parseCometLine(strings.Replace(borisovLine, "3.356633", "1.000000", 1))
+	assert.NoError(t, err)
+	assert.Equal(t, 2.006548, perihelionDistance(parabolic))
+	assert.Equal(t, 2.006548, dimensionFields["perihelion"](parabolic))
+	assert.True(t, math.IsNaN(semimajorAxis(parabolic)), "parabolic orbits have no semi-major axis")
+
+	dimensions := BuildDimensions(DefaultAlbedo())
+	for _, dimension := range dimensions {
+		switch dimension.Name {
+		case "Semi-Major-Axis", "Aphelion", "Orbital-Period":
+			assert.True(t, math.IsNaN(dimension.Value(parabolic)), dimension.Name)
+			assert.True(t, dimension.Extractor.ExtractCell(parabolic) < 0, dimension.Name)
+		}
+	}
+}
+
+func TestCometReader(t *testing.T) {
+	reader := newCometReader(ioutil.NopCloser(strings.NewReader(halleyLine + "\n" + borisovLine + "\n")))
+
+	first, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "1P", first.ID)
+
+	second, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "C/2019 Q4", second.ID)
+
+	_, err = reader.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestCometAphelionExcluded(t *testing.T) {
+	dimension := buildCometAphelion()
+
+	// q = 2, e = 0.993 gives an aphelion of about 569 AU
+	distant := &gompcreader.MinorPlanet{SemimajorAxis: 2 / (1 - 0.993), OrbitalEccentricity: 0.993}
+	cell := dimension.Extractor.ExtractCell(distant)
+	assert.Equal(t, int32(-1), cell)
+	assert.Equal(t, int32(dimension.GridSize+overflowCell), excludedCell(dimension, dimension.Value(distant), cell))
+
+	hyperbolic := &gompcreader.MinorPlanet{SemimajorAxis: 2 / (1 - 1.1), OrbitalEccentricity: 1.1}
+	assert.Equal(t, int32(101), dimension.Extractor.ExtractCell(hyperbolic))
+	assert.True(t, math.IsNaN(dimension.Value(hyperbolic)))
+}
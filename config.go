@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wselwood/gompcreader"
+	"gopkg.in/yaml.v2"
+)
+
+/*
+DimensionConfig is one dimension as written in a dimensions file. Field names either a value from the
+record or a quantity derived from it, see dimensionFields for the list. Expression can be used instead of
+Field to work the value out with a formula, see CompileExpression.
+*/
+type DimensionConfig struct {
+	Name        string       `json:"name" yaml:"name"`
+	Field       string       `json:"field" yaml:"field"`
+	Expression  string       `json:"expression,omitempty" yaml:"expression,omitempty"`
+	Min         float64      `json:"min" yaml:"min"`
+	Max         float64      `json:"max" yaml:"max"`
+	Grid        int          `json:"grid" yaml:"grid"`
+	Binning     string       `json:"binning,omitempty" yaml:"binning,omitempty"`
+	Description string       `json:"description,omitempty" yaml:"description,omitempty"`
+	Boundaries  []Boundary   `json:"boundaries,omitempty" yaml:"boundaries,omitempty"`
+	Albedo      *AlbedoModel `json:"albedo,omitempty" yaml:"albedo,omitempty"`
+}
+
+/*
+maxGridSize stops a typo in a dimensions file creating grids that will not fit in memory.
+*/
+const maxGridSize = 1000
+
+/*
+dimensionFields are the values a configured dimension can be built from. Missing values are NaN and
+are left out of the grid. The diameter is not here as it depends on the albedo, see diameterField.
+*/
+var dimensionFields = map[string]func(*gompcreader.MinorPlanet) float64{
+	"aphelion":               aphelionDistance,
+	"perihelion":             perihelionDistance,
+	"semimajor-axis":         semimajorAxis,
+	"eccentricity":           func(in *gompcreader.MinorPlanet) float64 { return in.OrbitalEccentricity },
+	"inclination":            func(in *gompcreader.MinorPlanet) float64 { return in.InclinationToTheEcliptic },
+	"absolute-magnitude":     func(in *gompcreader.MinorPlanet) float64 { return in.AbsoluteMagnitude },
+	"slope":                  func(in *gompcreader.MinorPlanet) float64 { return in.Slope },
+	"mean-anomaly":           func(in *gompcreader.MinorPlanet) float64 { return in.MeanAnomalyEpoch },
+	"argument-of-perihelion": func(in *gompcreader.MinorPlanet) float64 { return in.ArgumentOfPerihelion },
+	"ascending-node":         func(in *gompcreader.MinorPlanet) float64 { return in.LongitudeOfTheAscendingNode },
+	"mean-daily-motion":      func(in *gompcreader.MinorPlanet) float64 { return in.MeanDailyMotion },
+	"rms-residual": func(in *gompcreader.MinorPlanet) float64 {
+		if in.RmsResidual == 0 {
+			return math.NaN()
+		}
+		return in.RmsResidual
+	},
+	"orbital-period":    orbitalPeriod,
+	"tisserand-jupiter": tisserandJupiter,
+	"jupiter-resonance": meanMotionRatio,
+	"observations":      func(in *gompcreader.MinorPlanet) float64 { return float64(in.NumberOfObservations) },
+	"oppositions":       func(in *gompcreader.MinorPlanet) float64 { return float64(in.NumberOfOppositions) },
+	"arc-length":        arcLength,
+	"year-of-first-obs": func(in *gompcreader.MinorPlanet) float64 {
+		return missingIfZero(in.YearOfFirstObservation)
+	},
+	"year-of-last-obs": func(in *gompcreader.MinorPlanet) float64 {
+		return missingIfZero(in.YearOfLastObservation)
+	},
+	"first-observation": firstObservation,
+	"last-observation":  lastObservation,
+	"epoch":             epochOfOsculation,
+}
+
+/*
+diameterField is the name of the estimated diameter field, its value comes from the albedo model.
+*/
+const diameterField = "diameter"
+
+/*
+categoricalFields are the values a dimension with category binning can be built from.
+*/
+var categoricalFields = map[string]categoricalField{
+	"uncertainty": uncertaintyField,
+	"orbit-class": orbitClassField,
+}
+
+/*
+fieldFormats holds labels in better units for fields that need them.
+*/
+var fieldFormats = map[string]func(float64) string{
+	"orbital-period": formatPeriod,
+	"diameter":       formatDiameter,
+	"observations":   formatCount,
+	"oppositions":    formatCount,
+	"arc-length":     formatDays,
+	// dates are decimal years
+	"first-observation": formatMonth,
+	"last-observation":  formatMonth,
+	"epoch":             formatMonth,
+}
+
+func missingIfZero(in int64) float64 {
+	if in == 0 {
+		return math.NaN()
+	}
+	return float64(in)
+}
+
+/*
+LinearExtractor splits the range of a field into equal sized cells.
+*/
+type LinearExtractor struct {
+	field    func(*gompcreader.MinorPlanet) float64
+	minValue float64
+	maxValue float64
+	gridSize int
+	stepSize float64
+}
+
+/*
+ExtractCell for the field. Values outside the range are left out, the max value goes in the last cell.
+*/
+func (extractor *LinearExtractor) ExtractCell(in *gompcreader.MinorPlanet) int32 {
+	value := extractor.field(in)
+	if math.IsNaN(value) || value < extractor.minValue || value > extractor.maxValue {
+		return -1
+	}
+	cell := int((value - extractor.minValue) / extractor.stepSize)
+	if cell >= extractor.gridSize {
+		cell = extractor.gridSize - 1
+	}
+	return int32(cell)
+}
+
+/*
+Extract the start value of the cell
+*/
+func (extractor *LinearExtractor) Extract(in *gompcreader.MinorPlanet) string {
+	cell := extractor.ExtractCell(in)
+	if cell < 0 {
+		return ""
+	}
+	start := round(extractor.minValue+float64(cell)*extractor.stepSize, 6)
+	return strconv.FormatFloat(start, 'f', -1, 64)
+}
+
+/*
+LoadDimensions reads dimension definitions from a json or yaml file, picked by the file extension,
+and builds them. Diameter dimensions without an albedo of their own use the albedo given.
+*/
+func LoadDimensions(path string, albedo *AlbedoModel) ([]Dimension, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []DimensionConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &configs)
+	default:
+		err = json.Unmarshal(data, &configs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read dimensions from %s: %v", path, err)
+	}
+
+	result, err := BuildConfiguredDimensions(configs, albedo)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dimensions in %s: %v", path, err)
+	}
+	return result, nil
+}
+
+/*
+BuildConfiguredDimensions checks the configs and turns them into dimensions. All the problems found
+are reported together. albedo is used for diameter dimensions that do not set their own.
+*/
+func BuildConfiguredDimensions(configs []DimensionConfig, albedo *AlbedoModel) ([]Dimension, error) {
+	var problems []string
+	if len(configs) == 0 {
+		problems = append(problems, "no dimensions defined")
+	}
+
+	seen := make(map[string]bool)
+	var result []Dimension
+	for i, config := range configs {
+		if config.Name != "" {
+			if seen[config.Name] {
+				problems = append(problems, fmt.Sprintf("dimension %d: duplicate name %q", i+1, config.Name))
+			}
+			seen[config.Name] = true
+		}
+
+		dimension, err := buildConfiguredDimension(config, albedo)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("dimension %d: %v", i+1, err))
+			continue
+		}
+		result = append(result, dimension)
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return result, nil
+}
+
+func buildConfiguredDimension(config DimensionConfig, albedo *AlbedoModel) (Dimension, error) {
+	var result Dimension
+
+	if config.Name == "" {
+		return result, fmt.Errorf("missing name")
+	}
+	if strings.ContainsAny(config.Name, "/\\") || config.Name == "." || config.Name == ".." {
+		return result, fmt.Errorf("name %q can not be used as a folder name", config.Name)
+	}
+	if config.Binning == "category" {
+		return buildCategoricalConfig(config)
+	}
+	var field func(*gompcreader.MinorPlanet) float64
+	if config.Expression != "" {
+		if config.Field != "" {
+			return result, fmt.Errorf("%s can have a field or an expression but not both", config.Name)
+		}
+		compiled, err := CompileExpression(config.Expression)
+		if err != nil {
+			return result, fmt.Errorf("%s expression %q: %v", config.Name, config.Expression, err)
+		}
+		field = compiled
+	} else if config.Field != diameterField {
+		known, ok := dimensionFields[config.Field]
+		if !ok {
+			return result, fmt.Errorf("%s has unknown field %q, expected one of %s", config.Name, config.Field, strings.Join(fieldNames(), ", "))
+		}
+		field = known
+	}
+	if config.Binning != "quantile" && !(config.Max > config.Min) {
+		return result, fmt.Errorf("%s max %v must be greater than min %v", config.Name, config.Max, config.Min)
+	}
+	if config.Binning == "month" {
+		// whole years of months, the grid follows from the range
+		if config.Min != math.Floor(config.Min) || config.Max != math.Floor(config.Max) {
+			return result, fmt.Errorf("%s month binning needs min and max to be whole years", config.Name)
+		}
+		config.Grid = int(config.Max-config.Min) * 12
+	}
+	if config.Grid < 1 || config.Grid > maxGridSize {
+		return result, fmt.Errorf("%s grid %d must be between 1 and %d", config.Name, config.Grid, maxGridSize)
+	}
+
+	if config.Field == diameterField {
+		model := config.Albedo
+		if model == nil {
+			model = albedo
+		}
+		if err := model.validate(); err != nil {
+			return result, fmt.Errorf("%s %v", config.Name, err)
+		}
+		field = model.Diameter
+		result.Albedo = model
+	} else if config.Albedo != nil {
+		return result, fmt.Errorf("%s albedo can only be set for the diameter field", config.Name)
+	}
+	for _, boundary := range config.Boundaries {
+		if boundary.Value < config.Min || boundary.Value > config.Max {
+			return result, fmt.Errorf("%s boundary %v is outside min to max", config.Name, boundary.Value)
+		}
+	}
+
+	result.Name = config.Name
+	result.Boundaries = config.Boundaries
+	if config.Binning != "angular" {
+		result.Value = field
+	}
+	result.MinValue = config.Min
+	result.MaxValue = config.Max
+	result.GridSize = config.Grid
+	result.StepSize = (config.Max - config.Min) / float64(config.Grid)
+	result.Description = config.Description
+
+	switch config.Binning {
+	case "", "linear":
+		result.Extractor = &LinearExtractor{field, config.Min, config.Max, config.Grid, result.StepSize}
+	case "log":
+		if config.Min <= 0 {
+			return result, fmt.Errorf("%s log binning needs min to be greater than 0", config.Name)
+		}
+		result.StepSize = math.Log10(config.Max/config.Min) / float64(config.Grid)
+		result.Scale = "log"
+		result.Extractor = &LogExtractor{field, config.Min, config.Max, int32(config.Grid), fieldFormats[config.Field]}
+	case "quantile":
+		// the edges come from the data, see AutoRange
+		result.Scale = "quantile"
+		result.Extractor = &QuantileExtractor{field, nil, fieldFormats[config.Field]}
+	case "month":
+		result.Scale = "month"
+		result.Extractor = &MonthExtractor{field, config.Min, int32(config.Grid)}
+	case "angular":
+		if config.Max-config.Min != 360 {
+			return result, fmt.Errorf("%s angular binning needs max - min to be 360", config.Name)
+		}
+		result.Extractor = &AngleExtractor{field, config.Min, int32(config.Grid)}
+	default:
+		return result, fmt.Errorf("%s has unknown binning %q", config.Name, config.Binning)
+	}
+
+	return result, nil
+}
+
+/*
+buildCategoricalConfig builds a dimension from one of the categoricalFields or the hex flags. The cells
+come from the field so min, max and grid are not used.
+*/
+func buildCategoricalConfig(config DimensionConfig) (Dimension, error) {
+	if len(config.Boundaries) > 0 || config.Albedo != nil {
+		return Dimension{}, fmt.Errorf("%s category dimensions can not have boundaries or an albedo", config.Name)
+	}
+
+	var result Dimension
+	if config.Field == "flags" {
+		result = buildFlags()
+		result.Name = config.Name
+	} else if field, ok := categoricalFields[config.Field]; ok {
+		result = buildCategorical(config.Name, field)
+	} else {
+		names := []string{"flags"}
+		for name := range categoricalFields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return result, fmt.Errorf("%s has unknown category field %q, expected one of %s", config.Name, config.Field, strings.Join(names, ", "))
+	}
+
+	if config.Description != "" {
+		result.Description = config.Description
+	}
+	return result, nil
+}
+
+func fieldNames() []string {
+	var result []string
+	for name := range dimensionFields {
+		result = append(result, name)
+	}
+	result = append(result, diameterField)
+	sort.Strings(result)
+	return result
+}
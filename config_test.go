@@ -0,0 +1,169 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wselwood/gompcreader"
+)
+
+func TestLoadDimensionsYaml(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astro-grid")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dimensions.yaml")
+	yaml := `
+- name: Semi-Major-Axis
+  field: semimajor-axis
+  min: 0
+  max: 5
+  grid: 50
+- name: Eccentricity
+  field: eccentricity
+  min: 0
+  max: 1
+  grid: 20
+  description: Orbital eccentricity
+`
+	assert.NoError(t, ioutil.WriteFile(path, []byte(yaml), 0666))
+
+	dimensions, err := LoadDimensions(path, DefaultAlbedo())
+	assert.NoError(t, err)
+	assert.Len(t, dimensions, 2)
+	assert.Equal(t, "Semi-Major-Axis", dimensions[0].Name)
+	assert.Equal(t, 0.1, dimensions[0].StepSize)
+	assert.Equal(t, "Orbital eccentricity", dimensions[1].Description)
+
+	ceres, err := parseMpcorbLine(ceresLine)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(27), dimensions[0].Extractor.ExtractCell(ceres))
+	assert.Equal(t, "2.7", dimensions[0].Extractor.Extract(ceres))
+	assert.Equal(t, int32(1), dimensions[1].Extractor.ExtractCell(ceres))
+	assert.Equal(t, "0.05", dimensions[1].Extractor.Extract(ceres))
+}
+
+func TestLoadDimensionsExample(t *testing.T) {
+	dimensions, err := LoadDimensions("dimensions.example.json", DefaultAlbedo())
+	assert.NoError(t, err)
+	builtIn := BuildDimensions(DefaultAlbedo())
+	byName := make(map[string]Dimension)
+	for _, dimension := range dimensions {
+		byName[dimension.Name] = dimension
+	}
+
+	// the example has every built in dimension plus the month ones and the Jupiter resonances, which are only
+	// used when asked for
+	assert.Len(t, dimensions, len(builtIn)+4)
+	assert.Equal(t, "month", byName["First-Observation-Month"].Scale)
+	assert.Equal(t, "month", byName["Last-Observation-Month"].Scale)
+	assert.Equal(t, "month", byName["Epoch"].Scale)
+
+	resonance := byName["Jupiter-Mean-Motion-Ratio"]
+	var input gompcreader.MinorPlanet
+	input.MeanDailyMotion = 0.2492559 * 1.001
+	assert.Equal(t, int32(250), resonance.Extractor.ExtractCell(&input))
+	assert.Len(t, resonance.Boundaries, 10)
+	for _, boundary := range resonance.Boundaries {
+		assert.True(t, boundary.Value >= resonance.MinValue && boundary.Value <= resonance.MaxValue, boundary.Label)
+	}
+
+	ceres, _ := parseMpcorbLine(ceresLine)
+	single, _ := parseMpcorbLine(singleOppositionLine)
+	for _, expected := range builtIn {
+		configured, ok := byName[expected.Name]
+		if !assert.True(t, ok, expected.Name) {
+			continue
+		}
+		assert.Equal(t, expected.GridSize, configured.GridSize, expected.Name)
+		for _, record := range []*gompcreader.MinorPlanet{ceres, single} {
+			// the built in extractors can give cells past the end of the grid, these are dropped the same as -1
+			want := inGrid(expected, []int32{expected.Extractor.ExtractCell(record)})
+			got := inGrid(configured, []int32{configured.Extractor.ExtractCell(record)})
+			assert.Equal(t, want, got, expected.Name)
+		}
+	}
+}
+
+func TestBuildConfiguredDimensionsErrors(t *testing.T) {
+	valid := DimensionConfig{Name: "Aphelion", Field: "aphelion", Min: 0, Max: 10, Grid: 100}
+
+	cases := map[string]func(config *DimensionConfig){
+		"missing name":  func(config *DimensionConfig) { config.Name = "" },
+		"path in name":  func(config *DimensionConfig) { config.Name = "a/b" },
+		"unknown field": func(config *DimensionConfig) { config.Field = "colour" },
+		"empty range":   func(config *DimensionConfig) { config.Max = config.Min },
+		"no cells":      func(config *DimensionConfig) { config.Grid = 0 },
+		"huge grid":     func(config *DimensionConfig) { config.Grid = maxGridSize + 1 },
+		"bad binning":   func(config *DimensionConfig) { config.Binning = "spiral" },
+	}
+	for name, change := range cases {
+		config := valid
+		change(&config)
+		_, err := BuildConfiguredDimensions([]DimensionConfig{config}, DefaultAlbedo())
+		assert.Error(t, err, name)
+	}
+
+	_, err := BuildConfiguredDimensions([]DimensionConfig{valid, valid}, DefaultAlbedo())
+	assert.Error(t, err, "duplicate names")
+
+	_, err = BuildConfiguredDimensions(nil, DefaultAlbedo())
+	assert.Error(t, err, "nothing defined")
+}
+
+func TestLinearExtractorRange(t *testing.T) {
+	dimensions, err := BuildConfiguredDimensions([]DimensionConfig{
+		{Name: "Year", Field: "year-of-first-obs", Min: 1900, Max: 2000, Grid: 100},
+	}, DefaultAlbedo())
+	assert.NoError(t, err)
+	extractor := dimensions[0].Extractor
+
+	cases := []struct {
+		year int64
+		cell int32
+	}{
+		{0, -1},
+		{1899, -1},
+		{1900, 0},
+		{1999, 99},
+		{2000, 99},
+		{2001, -1},
+	}
+	for _, c := range cases {
+		ceres, _ := parseMpcorbLine(ceresLine)
+		ceres.YearOfFirstObservation = c.year
+		assert.Equal(t, c.cell, extractor.ExtractCell(ceres), "year %d", c.year)
+	}
+}
+
+func TestCategoryDimensionConfig(t *testing.T) {
+	dimensions, err := BuildConfiguredDimensions([]DimensionConfig{
+		{Name: "U", Field: "uncertainty", Binning: "category"},
+	}, DefaultAlbedo())
+	assert.NoError(t, err)
+	assert.Equal(t, 13, dimensions[0].GridSize)
+	assert.Equal(t, "category", dimensions[0].Scale)
+	assert.Equal(t, Bucket{10, "E"}, dimensions[0].Buckets[10])
+
+	_, err = BuildConfiguredDimensions([]DimensionConfig{
+		{Name: "U", Field: "eccentricity", Binning: "category"},
+	}, DefaultAlbedo())
+	assert.Error(t, err, "not a category field")
+}
+
+func TestMonthDimensionConfig(t *testing.T) {
+	dimensions, err := BuildConfiguredDimensions([]DimensionConfig{
+		{Name: "Epoch", Field: "epoch", Min: 2000, Max: 2010, Binning: "month"},
+	}, DefaultAlbedo())
+	assert.NoError(t, err)
+	assert.Equal(t, 120, dimensions[0].GridSize)
+	assert.Equal(t, "month", dimensions[0].Scale)
+
+	_, err = BuildConfiguredDimensions([]DimensionConfig{
+		{Name: "Epoch", Field: "epoch", Min: 2000.5, Max: 2010, Binning: "month"},
+	}, DefaultAlbedo())
+	assert.Error(t, err, "part years")
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/wselwood/gompcreader"
+)
+
+/*
+AlbedoModel is the geometric albedo assumed when working out diameters. Classes overrides the default
+for the orbit classes listed, e.g. trans-Neptunian objects are darker than the main belt.
+*/
+type AlbedoModel struct {
+	Default float64            `json:"default" yaml:"default"`
+	Classes map[string]float64 `json:"classes,omitempty" yaml:"classes,omitempty"`
+}
+
+/*
+DefaultAlbedo is the usual 0.14 assumed for asteroids of unknown type.
+*/
+func DefaultAlbedo() *AlbedoModel {
+	return &AlbedoModel{Default: 0.14}
+}
+
+/*
+ParseAlbedo builds an albedo model from a default and class values in the form class=albedo,class=albedo.
+*/
+func ParseAlbedo(defaultAlbedo float64, classes string) (*AlbedoModel, error) {
+	var result AlbedoModel
+	result.Default = defaultAlbedo
+
+	if classes != "" {
+		result.Classes = make(map[string]float64)
+		for _, part := range strings.Split(classes, ",") {
+			pieces := strings.SplitN(part, "=", 2)
+			if len(pieces) != 2 {
+				return nil, fmt.Errorf("invalid albedo entry %q, expected class=albedo", part)
+			}
+			albedo, err := strconv.ParseFloat(strings.TrimSpace(pieces[1]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid albedo in entry %q", part)
+			}
+			result.Classes[strings.TrimSpace(pieces[0])] = albedo
+		}
+	}
+
+	if err := result.validate(); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (model *AlbedoModel) validate() error {
+	if model.Default <= 0 || model.Default > 1 {
+		return fmt.Errorf("albedo %v must be between 0 and 1", model.Default)
+	}
+	for class, albedo := range model.Classes {
+		if !isOrbitClass(class) {
+			return fmt.Errorf("unknown orbit class %q for albedo, expected one of %s", class, strings.Join(orbitClasses, ", "))
+		}
+		if albedo <= 0 || albedo > 1 {
+			return fmt.Errorf("albedo %v for %s must be between 0 and 1", albedo, class)
+		}
+	}
+	return nil
+}
+
+/*
+Albedo gives the albedo to assume for the object.
+*/
+func (model *AlbedoModel) Albedo(in *gompcreader.MinorPlanet) float64 {
+	if albedo, ok := model.Classes[orbitClass(in)]; ok {
+		return albedo
+	}
+	return model.Default
+}
+
+/*
+Diameter estimates the diameter in km from the absolute magnitude, D = 1329 / sqrt(p) * 10^(-H/5)
+Objects without an H, which the readers give as NaN, have no diameter.
+*/
+func (model *AlbedoModel) Diameter(in *gompcreader.MinorPlanet) float64 {
+	if math.IsNaN(in.AbsoluteMagnitude) {
+		return math.NaN()
+	}
+	return 1329 / math.Sqrt(model.Albedo(in)) * math.Pow(10, -in.AbsoluteMagnitude/5)
+}
+
+/*
+formatDiameter labels a diameter in km using metres for small objects.
+*/
+func formatDiameter(km float64) string {
+	switch {
+	case km < 1:
+		return fmt.Sprintf("%.0f m", km*1000)
+	case km < 100:
+		return fmt.Sprintf("%.1f km", km)
+	}
+	return fmt.Sprintf("%.0f km", km)
+}
+
+func isOrbitClass(name string) bool {
+	for _, class := range orbitClasses {
+		if class == name {
+			return true
+		}
+	}
+	return false
+}
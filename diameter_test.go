@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wselwood/gompcreader"
+)
+
+func TestDiameter(t *testing.T) {
+	var input gompcreader.MinorPlanet
+	input.SemimajorAxis = 2.7
+	input.OrbitalEccentricity = 0.1
+	input.AbsoluteMagnitude = 15
+
+	assert.InDelta(t, 3.552, DefaultAlbedo().Diameter(&input), 0.001)
+
+	input.AbsoluteMagnitude = 17.75
+	model := &AlbedoModel{Default: 0.25}
+	assert.InDelta(t, 0.749, model.Diameter(&input), 0.001)
+}
+
+func TestDiameterClassAlbedo(t *testing.T) {
+	model, err := ParseAlbedo(0.14, "tno=0.09, trojan=0.07")
+	assert.NoError(t, err)
+
+	var tno gompcreader.MinorPlanet
+	tno.SemimajorAxis = 44
+	tno.OrbitalEccentricity = 0.05
+	assert.Equal(t, 0.09, model.Albedo(&tno))
+
+	var mba gompcreader.MinorPlanet
+	mba.SemimajorAxis = 2.7
+	mba.OrbitalEccentricity = 0.1
+	assert.Equal(t, 0.14, model.Albedo(&mba))
+}
+
+func TestParseAlbedoErrors(t *testing.T) {
+	_, err := ParseAlbedo(0, "")
+	assert.Error(t, err, "zero albedo")
+
+	_, err = ParseAlbedo(0.14, "tno")
+	assert.Error(t, err, "missing value")
+
+	_, err = ParseAlbedo(0.14, "plutino=0.1")
+	assert.Error(t, err, "unknown class")
+
+	_, err = ParseAlbedo(0.14, "tno=1.5")
+	assert.Error(t, err, "albedo over 1")
+}
+
+func TestDiameterExtractor(t *testing.T) {
+	extractor := buildDiameter(DefaultAlbedo()).Extractor
+
+	var input gompcreader.MinorPlanet
+	input.SemimajorAxis = 2.7
+	input.OrbitalEccentricity = 0.1
+	input.AbsoluteMagnitude = 15
+	assert.Equal(t, int32(35), extractor.ExtractCell(&input))
+	assert.Equal(t, "3.2 km", extractor.Extract(&input))
+
+	input.AbsoluteMagnitude = 22
+	assert.Equal(t, int32(21), extractor.ExtractCell(&input))
+	assert.Equal(t, "126 m", extractor.Extract(&input))
+}
+
+func TestDiameterWithoutMagnitude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astro-grid")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	blank, err := parseMpcorbLine(strings.Replace(ceresLine, " 3.34", "     ", 1))
+	assert.NoError(t, err)
+	assert.True(t, math.IsNaN(blank.AbsoluteMagnitude), "a blank H is not known rather than zero")
+	assert.True(t, math.IsNaN(DefaultAlbedo().Diameter(blank)))
+
+	dimensions := []Dimension{buildDiameter(DefaultAlbedo()), buildAbsoluteMagnitude()}
+	run, err := ProcessRecords(NewSliceSource("test", []*gompcreader.MinorPlanet{blank}), dimensions, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, Exclusions{1, 0, 0, 1}, run.Excluded[0])
+	assert.Equal(t, Exclusions{1, 0, 0, 1}, run.Excluded[1])
+}
+
+func TestConfiguredDiameterAlbedo(t *testing.T) {
+	model, err := ParseAlbedo(0.05, "tno=0.09")
+	assert.NoError(t, err)
+
+	configs := []DimensionConfig{
+		{Name: "Diameter", Field: "diameter", Min: 0.001, Max: 10000, Grid: 70, Binning: "log"},
+		{Name: "Bright-Diameter", Field: "diameter", Min: 0.001, Max: 10000, Grid: 70, Binning: "log",
+			Albedo: &AlbedoModel{Default: 0.25}},
+	}
+	dimensions, err := BuildConfiguredDimensions(configs, model)
+	assert.NoError(t, err)
+	assert.Equal(t, model, dimensions[0].Albedo, "the albedo given is the default")
+	assert.Equal(t, 0.25, dimensions[1].Albedo.Default, "the dimension's own albedo wins")
+
+	var input gompcreader.MinorPlanet
+	input.AbsoluteMagnitude = 15
+	assert.Equal(t, model.Diameter(&input), dimensions[0].Value(&input))
+}
@@ -5,42 +5,81 @@ import (
 	"fmt"
 	"log"
 	"os"
+
+	"github.com/wselwood/gompcreader"
 )
 
 /*
-Dimension defines an axis on the result
+Dimension defines an axis on the result. Scale is "log" when the cells are log spaced, StepSize is then
+the number of decades in each cell. Scale is "category" when each cell is a named bucket and "quantile" when
+the cells have different widths, Edges then holds the start of each cell and the end of the last one.
+Scale is "month" for dates in decimal years with a cell for each calendar month.
+MultiValued dimensions can count one record in several cells, so their cells do not add up to the total.
+Value is the raw value being binned, it is only set for numeric dimensions that can be given a new range.
+Excluded is filled in after a run with the records that did not make it into any cell.
 */
 type Dimension struct {
-	Name        string         `json:"n"`
-	MinValue    float64        `json:"min"`
-	MaxValue    float64        `json:"max"`
-	GridSize    int            `json:"grid"`
-	StepSize    float64        `json:"step"`
-	Description string         `json:"desc"`
-	Extractor   ValueExtractor `json:"-"`
+	Name        string                                 `json:"n"`
+	MinValue    float64                                `json:"min"`
+	MaxValue    float64                                `json:"max"`
+	GridSize    int                                    `json:"grid"`
+	StepSize    float64                                `json:"step"`
+	Description string                                 `json:"desc"`
+	Scale       string                                 `json:"scale,omitempty"`
+	Edges       []float64                              `json:"edges,omitempty"`
+	Buckets     []Bucket                               `json:"buckets,omitempty"`
+	Boundaries  []Boundary                             `json:"boundaries,omitempty"`
+	Albedo      *AlbedoModel                           `json:"albedo,omitempty"`
+	MultiValued bool                                   `json:"multi,omitempty"`
+	AutoRanged  bool                                   `json:"auto,omitempty"`
+	Excluded    *Exclusions                            `json:"excluded,omitempty"`
+	Extractor   ValueExtractor                         `json:"-"`
+	Value       func(*gompcreader.MinorPlanet) float64 `json:"-"`
 }
 
 /*
-NumDimentions contains the number of dimensions we are processing.
+Bucket is a named cell on a dimension that holds values outside the normal numeric range.
 */
-const NumDimentions = 8
+type Bucket struct {
+	Cell  int    `json:"cell"`
+	Label string `json:"label"`
+}
 
 /*
-BuildDimensions will create the standard set of dimensions
+Boundary is a value on a dimension that separates two classes of object, the viewer draws a line there.
 */
-func BuildDimensions() [NumDimentions]Dimension {
-	var result [NumDimentions]Dimension
-
-	result[0] = buildApohelion()
-	result[1] = buildPerihelion()
-	result[2] = buildYearOfFirstObs()
-	result[3] = buildYearOfLastObs()
-	result[4] = buildOrbitalEccentricity()
-	result[5] = buildInclinationToTheEcliptic()
-	result[6] = buildSemiMajorAxis()
-	result[7] = buildAbsoluteMagnitude()
+type Boundary struct {
+	Value float64 `json:"value"`
+	Label string  `json:"label"`
+}
 
-	return result
+/*
+BuildDimensions will create the standard set of dimensions, diameters are worked out with the albedo given
+*/
+func BuildDimensions(albedo *AlbedoModel) []Dimension {
+	return []Dimension{
+		buildApohelion(),
+		buildPerihelion(),
+		buildYearOfFirstObs(),
+		buildYearOfLastObs(),
+		buildOrbitalEccentricity(),
+		buildInclinationToTheEcliptic(),
+		buildSemiMajorAxis(),
+		buildAbsoluteMagnitude(),
+		buildArgumentOfPerihelion(),
+		buildLongitudeOfTheAscendingNode(),
+		buildMeanAnomaly(),
+		buildOrbitalPeriod(),
+		buildTisserandJupiter(),
+		buildDiameter(albedo),
+		buildNumberOfObservations(),
+		buildNumberOfOppositions(),
+		buildArcLength(),
+		buildUncertainty(),
+		buildRmsResidual(),
+		buildOrbitClass(),
+		buildFlags(),
+	}
 }
 
 func buildApohelion() Dimension {
@@ -52,6 +91,7 @@ func buildApohelion() Dimension {
 	result.GridSize = 100
 	result.StepSize = 0.1
 
+	result.Value = dimensionFields["aphelion"]
 	result.Extractor = &ApohelionExtractor{10, 10.0}
 
 	return result
@@ -66,6 +106,7 @@ func buildPerihelion() Dimension {
 	result.GridSize = 100
 	result.StepSize = 0.1
 
+	result.Value = dimensionFields["perihelion"]
 	result.Extractor = &PerihelionExtractor{10, 10.0}
 
 	return result
@@ -79,6 +120,7 @@ func buildYearOfFirstObs() Dimension {
 	result.MaxValue = 2015
 	result.GridSize = 101
 	result.StepSize = 1.0
+	result.Value = dimensionFields["year-of-first-obs"]
 	result.Extractor = &YearOfFirstObsExtractor{1915}
 
 	return result
@@ -92,6 +134,7 @@ func buildYearOfLastObs() Dimension {
 	result.MaxValue = 2015
 	result.GridSize = 101
 	result.StepSize = 1.0
+	result.Value = dimensionFields["year-of-last-obs"]
 	result.Extractor = &YearOfLastObsExtractor{1915}
 
 	return result
@@ -105,6 +148,7 @@ func buildOrbitalEccentricity() Dimension {
 	result.MaxValue = 1
 	result.GridSize = 100
 	result.StepSize = 0.01
+	result.Value = dimensionFields["eccentricity"]
 	result.Extractor = &OrbitalEccentricityExtractor{}
 
 	return result
@@ -118,6 +162,7 @@ func buildInclinationToTheEcliptic() Dimension {
 	result.MaxValue = 90
 	result.GridSize = 90
 	result.StepSize = 1.0
+	result.Value = dimensionFields["inclination"]
 	result.Extractor = &InclinationToTheEclipticExtractor{}
 
 	return result
@@ -131,6 +176,7 @@ func buildSemiMajorAxis() Dimension {
 	result.MaxValue = 10
 	result.GridSize = 100
 	result.StepSize = 0.1
+	result.Value = dimensionFields["semimajor-axis"]
 	result.Extractor = &SemimajorAxisExtractor{10, 10.0}
 
 	return result
@@ -145,10 +191,301 @@ func buildAbsoluteMagnitude() Dimension {
 	result.GridSize = 60
 	result.StepSize = 0.5
 
+	result.Value = dimensionFields["absolute-magnitude"]
 	result.Extractor = &AbsoluteMagnitudeExtractor{28, 10.0, 2, 5}
 	return result
 }
 
+func buildAngle(name string, field string, description string) Dimension {
+	var result Dimension
+
+	result.Name = name
+	result.MinValue = 0
+	result.MaxValue = 360
+	result.GridSize = 72
+	result.StepSize = 5.0
+	result.Description = description
+	result.Extractor = &AngleExtractor{dimensionFields[field], 0, 72}
+
+	return result
+}
+
+func buildArgumentOfPerihelion() Dimension {
+	return buildAngle("Argument-Of-Perihelion", "argument-of-perihelion", "Argument of perihelion in degrees, wraps at 360")
+}
+
+func buildLongitudeOfTheAscendingNode() Dimension {
+	return buildAngle("Longitude-Of-The-Ascending-Node", "ascending-node", "Longitude of the ascending node in degrees, wraps at 360")
+}
+
+func buildMeanAnomaly() Dimension {
+	return buildAngle("Mean-Anomaly", "mean-anomaly", "Mean anomaly at the epoch in degrees, wraps at 360")
+}
+
+func buildOrbitalPeriod() Dimension {
+	var result Dimension
+
+	result.Name = "Orbital-Period"
+	result.MinValue = 0.1
+	result.MaxValue = 10000
+	result.GridSize = 50
+	result.StepSize = 0.1
+	result.Scale = "log"
+	result.Description = "Orbital period in years from Kepler's third law, ten log spaced cells per factor of ten"
+	result.Value = orbitalPeriod
+	result.Extractor = &LogExtractor{orbitalPeriod, 0.1, 10000, 50, formatPeriod}
+
+	return result
+}
+
+func buildTisserandJupiter() Dimension {
+	var result Dimension
+
+	result.Name = "Tisserand-Jupiter"
+	result.MinValue = -2
+	result.MaxValue = 6
+	result.GridSize = 80
+	result.StepSize = 0.1
+	result.Description = "Tisserand parameter relative to Jupiter. Asteroidal orbits are above 3, cometary orbits below"
+	result.Boundaries = []Boundary{{3, "T_J = 3, asteroidal above, cometary below"}}
+	result.Value = tisserandJupiter
+	result.Extractor = &LinearExtractor{tisserandJupiter, -2, 6, 80, 0.1}
+
+	return result
+}
+
+func buildDiameter(albedo *AlbedoModel) Dimension {
+	var result Dimension
+
+	result.Name = "Diameter"
+	result.MinValue = 0.001
+	result.MaxValue = 10000
+	result.GridSize = 70
+	result.StepSize = 0.1
+	result.Scale = "log"
+	result.Description = "Estimated diameter in km from the absolute magnitude and the assumed albedo"
+	result.Albedo = albedo
+	result.Value = albedo.Diameter
+	result.Extractor = &LogExtractor{albedo.Diameter, 0.001, 10000, 70, formatDiameter}
+
+	return result
+}
+
+func buildNumberOfObservations() Dimension {
+	var result Dimension
+
+	result.Name = "Number-Of-Observations"
+	result.MinValue = 1
+	result.MaxValue = 100000
+	result.GridSize = 50
+	result.StepSize = 0.1
+	result.Scale = "log"
+	result.Description = "Number of observations used in the orbit, log spaced"
+	result.Value = dimensionFields["observations"]
+	result.Extractor = &LogExtractor{dimensionFields["observations"], 1, 100000, 50, formatCount}
+
+	return result
+}
+
+func buildNumberOfOppositions() Dimension {
+	var result Dimension
+
+	result.Name = "Number-Of-Oppositions"
+	result.MinValue = 1
+	result.MaxValue = 151
+	result.GridSize = 150
+	result.StepSize = 1
+	result.Description = "Number of oppositions the object has been observed at, one cell for each"
+	result.Value = dimensionFields["oppositions"]
+	result.Extractor = &LinearExtractor{dimensionFields["oppositions"], 1, 151, 150, 1}
+
+	return result
+}
+
+func buildArcLength() Dimension {
+	var result Dimension
+
+	result.Name = "Arc-Length"
+	result.MinValue = 1
+	result.MaxValue = 100000
+	result.GridSize = 50
+	result.StepSize = 0.1
+	result.Scale = "log"
+	result.Description = "Observed arc in days, log spaced. Multi-opposition orbits only give years so are rounded to whole years"
+	result.Value = arcLength
+	result.Extractor = &LogExtractor{arcLength, 1, 100000, 50, formatDays}
+
+	return result
+}
+
+/*
+categoricalDimension creates a dimension with one named cell for each label.
+*/
+func categoricalDimension(name string, labels []string, description string) Dimension {
+	var result Dimension
+
+	result.Name = name
+	result.MinValue = 0
+	result.MaxValue = float64(len(labels))
+	result.GridSize = len(labels)
+	result.StepSize = 1
+	result.Scale = "category"
+	result.Description = description
+	for i, label := range labels {
+		result.Buckets = append(result.Buckets, Bucket{i, label})
+	}
+
+	return result
+}
+
+/*
+categoricalField is a labelled value that can be used for a category dimension.
+*/
+type categoricalField struct {
+	labels      []string
+	label       func(*gompcreader.MinorPlanet) string
+	description string
+}
+
+func buildCategorical(name string, field categoricalField) Dimension {
+	result := categoricalDimension(name, field.labels, field.description)
+	result.Extractor = newCategoricalExtractor(field.labels, field.label)
+	return result
+}
+
+var uncertaintyField = categoricalField{
+	[]string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "E", "D", "F"},
+	func(in *gompcreader.MinorPlanet) string { return in.UncertaintyParameter },
+	"MPC uncertainty parameter U, 0 is the best determined orbit and 9 the worst. " +
+		"E is an assumed eccentricity, D a double designation and F a failed link between oppositions",
+}
+
+func buildUncertainty() Dimension {
+	return buildCategorical("Uncertainty", uncertaintyField)
+}
+
+func buildOrbitClass() Dimension {
+	return buildCategorical("Orbit-Class", orbitClassField)
+}
+
+func buildFlags() Dimension {
+	labels := make([]string, 0, len(mpcorbFlags)+1)
+	for _, flag := range mpcorbFlags {
+		labels = append(labels, flag.Label)
+	}
+	labels = append(labels, "none")
+
+	result := categoricalDimension("Flags", labels,
+		"Flags from the MPCORB hex flags. An object is counted once for every flag it has, "+
+			"so a PHA is also in the neo cell and the cells add up to more than the number of objects")
+	result.MultiValued = true
+	result.Extractor = &FlagsExtractor{mpcorbFlags}
+
+	return result
+}
+
+func buildRmsResidual() Dimension {
+	var result Dimension
+
+	result.Name = "RMS-Residual"
+	result.MinValue = 0
+	result.MaxValue = 2
+	result.GridSize = 40
+	result.StepSize = 0.05
+	result.Description = "RMS residual of the orbit fit in arc seconds"
+	result.Value = dimensionFields["rms-residual"]
+	result.Extractor = &LinearExtractor{dimensionFields["rms-residual"], 0, 2, 40, 0.05}
+
+	return result
+}
+
+/*
+BuildCometDimensions creates the dimensions used for comet orbits. These cope with parabolic
+and hyperbolic orbits by putting them in explicit buckets at the end of the grid.
+*/
+func BuildCometDimensions() []Dimension {
+	return []Dimension{
+		buildCometPerihelion(),
+		buildCometAphelion(),
+		buildCometEccentricity(),
+		buildCometInclination(),
+		buildCometAbsoluteMagnitude(),
+	}
+}
+
+func buildCometPerihelion() Dimension {
+	var result Dimension
+
+	result.Name = "Perihelion"
+	result.MinValue = 0
+	result.MaxValue = 10
+	result.GridSize = 100
+	result.StepSize = 0.1
+	result.Value = perihelionDistance
+	result.Extractor = &CometPerihelionExtractor{10, 10.0}
+
+	return result
+}
+
+func buildCometAphelion() Dimension {
+	var result Dimension
+
+	result.Name = "Aphelion"
+	result.MinValue = 0
+	result.MaxValue = 100
+	result.GridSize = 102
+	result.StepSize = 1.0
+	result.Description = "Aphelion distance in AU. Parabolic and hyperbolic orbits are in the unbound bucket"
+	result.Buckets = []Bucket{{101, "unbound"}}
+	result.Value = aphelionDistance
+	result.Extractor = &CometAphelionExtractor{100, 1.0, 101}
+
+	return result
+}
+
+func buildCometEccentricity() Dimension {
+	var result Dimension
+
+	result.Name = "Orbital-Eccentricity"
+	result.MinValue = 0
+	result.MaxValue = 1
+	result.GridSize = 102
+	result.StepSize = 0.01
+	result.Description = "Orbital eccentricity. Orbits with e = 1 and e > 1 are in their own buckets"
+	result.Buckets = []Bucket{{cometParabolicCell, "parabolic"}, {cometHyperbolicCell, "hyperbolic"}}
+	result.Extractor = &CometEccentricityExtractor{}
+
+	return result
+}
+
+func buildCometInclination() Dimension {
+	var result Dimension
+
+	result.Name = "Inclination-To-The-Ecliptic"
+	result.MinValue = 0
+	result.MaxValue = 180
+	result.GridSize = 180
+	result.StepSize = 1.0
+	result.Value = dimensionFields["inclination"]
+	result.Extractor = &CometInclinationExtractor{}
+
+	return result
+}
+
+func buildCometAbsoluteMagnitude() Dimension {
+	var result Dimension
+
+	result.Name = "Absolute-Magnitude"
+	result.MinValue = -2
+	result.MaxValue = 28
+	result.GridSize = 60
+	result.StepSize = 0.5
+	result.Value = dimensionFields["absolute-magnitude"]
+	result.Extractor = &AbsoluteMagnitudeExtractor{28, 10.0, 2, 5}
+
+	return result
+}
+
 /*
 RenderDimensions output the dimension listing to the outputDir given
 */
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/wselwood/gompcreader"
+)
+
+/*
+expressionVariables are the record values an expression can use. Angles are in degrees.
+*/
+var expressionVariables = map[string]func(*gompcreader.MinorPlanet) float64{
+	"a":    dimensionFields["semimajor-axis"],
+	"e":    dimensionFields["eccentricity"],
+	"i":    dimensionFields["inclination"],
+	"q":    dimensionFields["perihelion"],
+	"Q":    dimensionFields["aphelion"],
+	"H":    dimensionFields["absolute-magnitude"],
+	"G":    dimensionFields["slope"],
+	"M":    dimensionFields["mean-anomaly"],
+	"w":    dimensionFields["argument-of-perihelion"],
+	"node": dimensionFields["ascending-node"],
+	"n":    dimensionFields["mean-daily-motion"],
+	"P":    orbitalPeriod,
+	"Tj":   tisserandJupiter,
+	"nJ":   meanMotionRatio,
+	"nobs": dimensionFields["observations"],
+	"nopp": dimensionFields["oppositions"],
+	"arc":  arcLength,
+	"rms":  dimensionFields["rms-residual"],
+}
+
+/*
+expressionFunctions are the functions an expression can call. The trig functions take degrees to match
+the angles in the records.
+*/
+var expressionFunctions = map[string]func(float64) float64{
+	"sqrt":  math.Sqrt,
+	"abs":   math.Abs,
+	"exp":   math.Exp,
+	"ln":    math.Log,
+	"log10": math.Log10,
+	"sin":   func(x float64) float64 { return math.Sin(x * math.Pi / 180) },
+	"cos":   func(x float64) float64 { return math.Cos(x * math.Pi / 180) },
+	"tan":   func(x float64) float64 { return math.Tan(x * math.Pi / 180) },
+}
+
+/*
+CompileExpression parses an arithmetic expression over the expressionVariables, e.g. a*(1-e) or
+sqrt(a^3), into a function that evaluates it for a record. + - * / and ^ work as usual with ^ binding
+tightest, and pi is a constant. This is done once so the grid loop only pays for the arithmetic.
+*/
+func CompileExpression(source string) (func(*gompcreader.MinorPlanet) float64, error) {
+	tokens, err := tokenizeExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	parser := expressionParser{tokens: tokens}
+	result, err := parser.sum()
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(parser.tokens) {
+		return nil, fmt.Errorf("unexpected %q at %d", parser.peek().text, parser.peek().pos+1)
+	}
+	return result, nil
+}
+
+type expressionToken struct {
+	text string
+	pos  int
+}
+
+func tokenizeExpression(source string) ([]expressionToken, error) {
+	var result []expressionToken
+	runes := []rune(source)
+	for pos := 0; pos < len(runes); {
+		r := runes[pos]
+		start := pos
+		switch {
+		case unicode.IsSpace(r):
+			pos++
+			continue
+		case strings.ContainsRune("+-*/^()", r):
+			pos++
+		case unicode.IsDigit(r) || r == '.':
+			for pos < len(runes) && (unicode.IsDigit(runes[pos]) || runes[pos] == '.') {
+				pos++
+			}
+			// exponents, e.g. 1.5e-3
+			if pos+1 < len(runes) && (runes[pos] == 'e' || runes[pos] == 'E') &&
+				(unicode.IsDigit(runes[pos+1]) || (strings.ContainsRune("+-", runes[pos+1]) && pos+2 < len(runes) && unicode.IsDigit(runes[pos+2]))) {
+				pos = pos + 2
+				for pos < len(runes) && unicode.IsDigit(runes[pos]) {
+					pos++
+				}
+			}
+		case unicode.IsLetter(r) || r == '_':
+			for pos < len(runes) && (unicode.IsLetter(runes[pos]) || unicode.IsDigit(runes[pos]) || runes[pos] == '_') {
+				pos++
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", string(r), pos+1)
+		}
+		result = append(result, expressionToken{string(runes[start:pos]), start})
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	return result, nil
+}
+
+/*
+expressionParser is a recursive descent parser, one method for each level of precedence.
+*/
+type expressionParser struct {
+	tokens []expressionToken
+	pos    int
+}
+
+type compiledExpression func(*gompcreader.MinorPlanet) float64
+
+func (parser *expressionParser) peek() expressionToken {
+	if parser.pos >= len(parser.tokens) {
+		return expressionToken{"end of expression", len(parser.tokens[len(parser.tokens)-1].text) + parser.tokens[len(parser.tokens)-1].pos}
+	}
+	return parser.tokens[parser.pos]
+}
+
+func (parser *expressionParser) accept(text string) bool {
+	if parser.pos < len(parser.tokens) && parser.tokens[parser.pos].text == text {
+		parser.pos++
+		return true
+	}
+	return false
+}
+
+func (parser *expressionParser) sum() (compiledExpression, error) {
+	left, err := parser.product()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case parser.accept("+"):
+			right, err := parser.product()
+			if err != nil {
+				return nil, err
+			}
+			l := left
+			left = func(in *gompcreader.MinorPlanet) float64 { return l(in) + right(in) }
+		case parser.accept("-"):
+			right, err := parser.product()
+			if err != nil {
+				return nil, err
+			}
+			l := left
+			left = func(in *gompcreader.MinorPlanet) float64 { return l(in) - right(in) }
+		default:
+			return left, nil
+		}
+	}
+}
+
+func (parser *expressionParser) product() (compiledExpression, error) {
+	left, err := parser.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case parser.accept("*"):
+			right, err := parser.unary()
+			if err != nil {
+				return nil, err
+			}
+			l := left
+			left = func(in *gompcreader.MinorPlanet) float64 { return l(in) * right(in) }
+		case parser.accept("/"):
+			right, err := parser.unary()
+			if err != nil {
+				return nil, err
+			}
+			l := left
+			left = func(in *gompcreader.MinorPlanet) float64 { return l(in) / right(in) }
+		default:
+			return left, nil
+		}
+	}
+}
+
+func (parser *expressionParser) unary() (compiledExpression, error) {
+	if parser.accept("-") {
+		operand, err := parser.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(in *gompcreader.MinorPlanet) float64 { return -operand(in) }, nil
+	}
+	parser.accept("+")
+	return parser.power()
+}
+
+func (parser *expressionParser) power() (compiledExpression, error) {
+	base, err := parser.operand()
+	if err != nil {
+		return nil, err
+	}
+	if !parser.accept("^") {
+		return base, nil
+	}
+	// right associative, 2^3^2 is 2^9, and -a^2 is -(a^2)
+	exponent, err := parser.unary()
+	if err != nil {
+		return nil, err
+	}
+	return func(in *gompcreader.MinorPlanet) float64 { return math.Pow(base(in), exponent(in)) }, nil
+}
+
+func (parser *expressionParser) operand() (compiledExpression, error) {
+	token := parser.peek()
+	if parser.pos >= len(parser.tokens) {
+		return nil, fmt.Errorf("expression ends too soon")
+	}
+	parser.pos++
+
+	if token.text == "(" {
+		inner, err := parser.sum()
+		if err != nil {
+			return nil, err
+		}
+		if !parser.accept(")") {
+			return nil, fmt.Errorf("missing ) for ( at %d", token.pos+1)
+		}
+		return inner, nil
+	}
+	if first := rune(token.text[0]); unicode.IsDigit(first) || first == '.' {
+		value, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", token.text, token.pos+1)
+		}
+		return func(*gompcreader.MinorPlanet) float64 { return value }, nil
+	}
+	if function, ok := expressionFunctions[token.text]; ok {
+		if !parser.accept("(") {
+			return nil, fmt.Errorf("%s at %d needs its argument in brackets", token.text, token.pos+1)
+		}
+		argument, err := parser.sum()
+		if err != nil {
+			return nil, err
+		}
+		if !parser.accept(")") {
+			return nil, fmt.Errorf("missing ) for %s at %d", token.text, token.pos+1)
+		}
+		return func(in *gompcreader.MinorPlanet) float64 { return function(argument(in)) }, nil
+	}
+	if token.text == "pi" {
+		return func(*gompcreader.MinorPlanet) float64 { return math.Pi }, nil
+	}
+	if variable, ok := expressionVariables[token.text]; ok {
+		return variable, nil
+	}
+	if unicode.IsLetter(rune(token.text[0])) || token.text[0] == '_' {
+		return nil, fmt.Errorf("unknown name %q at %d, expected one of %s", token.text, token.pos+1, strings.Join(expressionNames(), ", "))
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", token.text, token.pos+1)
+}
+
+func expressionNames() []string {
+	var result []string
+	for name := range expressionVariables {
+		result = append(result, name)
+	}
+	for name := range expressionFunctions {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return append(result, "pi")
+}
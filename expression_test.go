@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wselwood/gompcreader"
+)
+
+func TestCompileExpression(t *testing.T) {
+	var input gompcreader.MinorPlanet
+	input.SemimajorAxis = 4
+	input.OrbitalEccentricity = 0.25
+	input.InclinationToTheEcliptic = 30
+	input.NumberOfObservations = 100
+
+	cases := []struct {
+		in  string
+		out float64
+	}{
+		{"a*(1-e)", 3},
+		{"a * (1 + e)", 5},
+		{"sqrt(a^3)", 8},
+		{"sin(i)*e", 0.125},
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"2^3^2", 512},
+		{"-a^2", -16},
+		{"2^-1", 0.5},
+		{"a / 2 / 2", 1},
+		{"a - 1 - 1", 2},
+		{"log10(nobs)", 2},
+		{"1.5e2 + q", 153},
+		{"pi", math.Pi},
+	}
+	for _, tt := range cases {
+		compiled, err := CompileExpression(tt.in)
+		if assert.NoError(t, err, tt.in) {
+			assert.InDelta(t, tt.out, compiled(&input), 1e-9, tt.in)
+		}
+	}
+}
+
+func TestCompileExpressionErrors(t *testing.T) {
+	cases := []string{
+		"",
+		"a*",
+		"(a+e",
+		"a e",
+		"colour",
+		"sqrt a",
+		"a $ e",
+		"1..2",
+		")",
+	}
+	for _, tt := range cases {
+		_, err := CompileExpression(tt)
+		assert.Error(t, err, tt)
+	}
+}
+
+func TestExpressionDimensionConfig(t *testing.T) {
+	dimensions, err := BuildConfiguredDimensions([]DimensionConfig{
+		{Name: "Perihelion", Expression: "a*(1-e)", Min: 0, Max: 10, Grid: 100},
+	}, DefaultAlbedo())
+	assert.NoError(t, err)
+	ceres, err := parseMpcorbLine(ceresLine)
+	assert.NoError(t, err)
+	assert.Equal(t, buildPerihelion().Extractor.ExtractCell(ceres), dimensions[0].Extractor.ExtractCell(ceres))
+
+	_, err = BuildConfiguredDimensions([]DimensionConfig{
+		{Name: "Perihelion", Field: "perihelion", Expression: "a*(1-e)", Min: 0, Max: 10, Grid: 100},
+	}, DefaultAlbedo())
+	assert.Error(t, err, "field and expression")
+
+	_, err = BuildConfiguredDimensions([]DimensionConfig{
+		{Name: "Perihelion", Expression: "a*(1-", Min: 0, Max: 10, Grid: 100},
+	}, DefaultAlbedo())
+	assert.Error(t, err, "bad expression")
+}
@@ -3,6 +3,10 @@ package main
 import (
 	"fmt"
 	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/wselwood/gompcreader"
 )
@@ -15,6 +19,14 @@ type ValueExtractor interface {
 	Extract(*gompcreader.MinorPlanet) string
 }
 
+/*
+MultiValueExtractor is for dimensions where a record can be in more than one cell at once, e.g. flags.
+The cells are appended to the buffer given so it can be reused between records.
+*/
+type MultiValueExtractor interface {
+	ExtractCells(in *gompcreader.MinorPlanet, buffer []int32) []int32
+}
+
 /*
 ApohelionExtractor extracts the values for Apohelion
 */
@@ -27,8 +39,7 @@ type ApohelionExtractor struct {
 ExtractCell extracts the cell value for Apohelion
 */
 func (extractor *ApohelionExtractor) ExtractCell(in *gompcreader.MinorPlanet) int32 {
-	CS := in.SemimajorAxis * in.OrbitalEccentricity
-	apohelion := in.SemimajorAxis + CS
+	apohelion := aphelionDistance(in)
 	return scaleAxis(apohelion, extractor.maxValue, extractor.multiplier)
 }
 
@@ -36,8 +47,7 @@ func (extractor *ApohelionExtractor) ExtractCell(in *gompcreader.MinorPlanet) in
 Extract extracts the start value for the bucket this MinorPlanet is in.
 */
 func (extractor *ApohelionExtractor) Extract(in *gompcreader.MinorPlanet) string {
-	CS := in.SemimajorAxis * in.OrbitalEccentricity
-	apohelion := in.SemimajorAxis + CS
+	apohelion := aphelionDistance(in)
 
 	return fmt.Sprintf("%3.1f", float64(int64(apohelion*extractor.multiplier))/extractor.multiplier)
 }
@@ -54,8 +64,7 @@ type PerihelionExtractor struct {
 ExtractCell extracts the cell value for Apohelion
 */
 func (extractor *PerihelionExtractor) ExtractCell(in *gompcreader.MinorPlanet) int32 {
-	CS := in.SemimajorAxis * in.OrbitalEccentricity
-	apohelion := in.SemimajorAxis - CS
+	apohelion := perihelionDistance(in)
 	return scaleAxis(apohelion, extractor.maxValue, extractor.multiplier)
 }
 
@@ -63,8 +72,7 @@ func (extractor *PerihelionExtractor) ExtractCell(in *gompcreader.MinorPlanet) i
 Extract extracts the start value for the bucket this MinorPlanet is in.
 */
 func (extractor *PerihelionExtractor) Extract(in *gompcreader.MinorPlanet) string {
-	CS := in.SemimajorAxis * in.OrbitalEccentricity
-	apohelion := in.SemimajorAxis - CS
+	apohelion := perihelionDistance(in)
 
 	return fmt.Sprintf("%3.1f", float64(int64(apohelion*extractor.multiplier))/extractor.multiplier)
 }
@@ -172,14 +180,14 @@ type SemimajorAxisExtractor struct {
 ExtractCell for the SemimajorAxisExtractor
 */
 func (extractor *SemimajorAxisExtractor) ExtractCell(in *gompcreader.MinorPlanet) int32 {
-	return scaleAxis(in.SemimajorAxis, extractor.maxValue, extractor.multiplier)
+	return scaleAxis(semimajorAxis(in), extractor.maxValue, extractor.multiplier)
 }
 
 /*
 Extract the SemimajorAxisExtractor
 */
 func (extractor *SemimajorAxisExtractor) Extract(in *gompcreader.MinorPlanet) string {
-	return fmt.Sprintf("%3.1f", float64(int64(in.SemimajorAxis*extractor.multiplier))/extractor.multiplier)
+	return fmt.Sprintf("%3.1f", float64(int64(semimajorAxis(in)*extractor.multiplier))/extractor.multiplier)
 }
 
 /*
@@ -209,6 +217,466 @@ func (extractor *AbsoluteMagnitudeExtractor) Extract(in *gompcreader.MinorPlanet
 	return fmt.Sprintf("%3.1f", float64(int64(in.AbsoluteMagnitude*2.0))/2.0)
 }
 
+/*
+CometPerihelionExtractor extracts perihelion distance for any orbit, including parabolic and hyperbolic comets.
+*/
+type CometPerihelionExtractor struct {
+	maxValue   float64
+	multiplier float64
+}
+
+/*
+ExtractCell for the perihelion distance
+*/
+func (extractor *CometPerihelionExtractor) ExtractCell(in *gompcreader.MinorPlanet) int32 {
+	return scaleAxis(perihelionDistance(in), extractor.maxValue, extractor.multiplier)
+}
+
+/*
+Extract the perihelion distance
+*/
+func (extractor *CometPerihelionExtractor) Extract(in *gompcreader.MinorPlanet) string {
+	return fmt.Sprintf("%3.1f", float64(int64(perihelionDistance(in)*extractor.multiplier))/extractor.multiplier)
+}
+
+/*
+CometAphelionExtractor extracts aphelion distance. Orbits with e >= 1 have no aphelion so they go in
+the unbound cell at the end of the grid.
+*/
+type CometAphelionExtractor struct {
+	maxValue    float64
+	multiplier  float64
+	unboundCell int32
+}
+
+/*
+ExtractCell for the aphelion distance
+*/
+func (extractor *CometAphelionExtractor) ExtractCell(in *gompcreader.MinorPlanet) int32 {
+	if in.OrbitalEccentricity >= 1 {
+		return extractor.unboundCell
+	}
+	return scaleAxis(aphelionDistance(in), extractor.maxValue, extractor.multiplier)
+}
+
+/*
+Extract the aphelion distance
+*/
+func (extractor *CometAphelionExtractor) Extract(in *gompcreader.MinorPlanet) string {
+	if in.OrbitalEccentricity >= 1 {
+		return "unbound"
+	}
+	return fmt.Sprintf("%3.1f", float64(int64(aphelionDistance(in)*extractor.multiplier))/extractor.multiplier)
+}
+
+/*
+CometEccentricityExtractor bins bound orbits by eccentricity with parabolic and hyperbolic
+orbits in their own cells after the 100 bound cells.
+*/
+type CometEccentricityExtractor struct {
+}
+
+const cometParabolicCell = 100
+const cometHyperbolicCell = 101
+
+/*
+ExtractCell for the eccentricity
+*/
+func (extractor *CometEccentricityExtractor) ExtractCell(in *gompcreader.MinorPlanet) int32 {
+	switch {
+	case in.OrbitalEccentricity == 1:
+		return cometParabolicCell
+	case in.OrbitalEccentricity > 1:
+		return cometHyperbolicCell
+	case in.OrbitalEccentricity < 0:
+		return -1
+	}
+	return int32(in.OrbitalEccentricity * 100)
+}
+
+/*
+Extract the eccentricity
+*/
+func (extractor *CometEccentricityExtractor) Extract(in *gompcreader.MinorPlanet) string {
+	switch {
+	case in.OrbitalEccentricity == 1:
+		return "parabolic"
+	case in.OrbitalEccentricity > 1:
+		return "hyperbolic"
+	}
+	return fmt.Sprintf("%3.2f", float64(int64(in.OrbitalEccentricity*100.0))/100.0)
+}
+
+/*
+CometInclinationExtractor covers the full 0-180 degree range as many comets are retrograde.
+*/
+type CometInclinationExtractor struct {
+}
+
+/*
+ExtractCell for the inclination
+*/
+func (extractor *CometInclinationExtractor) ExtractCell(in *gompcreader.MinorPlanet) int32 {
+	if in.InclinationToTheEcliptic >= 180.0 || in.InclinationToTheEcliptic < 0 {
+		return -1
+	}
+	return int32(in.InclinationToTheEcliptic)
+}
+
+/*
+Extract the inclination
+*/
+func (extractor *CometInclinationExtractor) Extract(in *gompcreader.MinorPlanet) string {
+	return fmt.Sprintf("%3.1f", float64(int(in.InclinationToTheEcliptic)))
+}
+
+/*
+AngleExtractor bins an angle in degrees. The angle is wrapped into the range start to start+360 first so
+values like -10 or 370 end up next to their neighbours rather than off the grid.
+*/
+type AngleExtractor struct {
+	angle    func(*gompcreader.MinorPlanet) float64
+	start    float64
+	gridSize int32
+}
+
+/*
+ExtractCell for the angle
+*/
+func (extractor *AngleExtractor) ExtractCell(in *gompcreader.MinorPlanet) int32 {
+	angle := extractor.angle(in)
+	if math.IsNaN(angle) || math.IsInf(angle, 0) {
+		return -1
+	}
+	cell := int32((wrapAngle(angle, extractor.start) - extractor.start) / extractor.stepSize())
+	if cell >= extractor.gridSize {
+		// rounding can put values just under start+360 past the last cell
+		cell = extractor.gridSize - 1
+	}
+	return cell
+}
+
+/*
+Extract the start of the angle's cell
+*/
+func (extractor *AngleExtractor) Extract(in *gompcreader.MinorPlanet) string {
+	cell := extractor.ExtractCell(in)
+	if cell < 0 {
+		return ""
+	}
+	return fmt.Sprintf("%3.1f", extractor.start+float64(cell)*extractor.stepSize())
+}
+
+func (extractor *AngleExtractor) stepSize() float64 {
+	return 360.0 / float64(extractor.gridSize)
+}
+
+/*
+wrapAngle moves an angle in degrees into the range start to start+360.
+*/
+func wrapAngle(angle float64, start float64) float64 {
+	wrapped := math.Mod(angle-start, 360)
+	if wrapped < 0 {
+		wrapped = wrapped + 360
+	}
+	return start + wrapped
+}
+
+/*
+CategoricalExtractor puts each record in the cell for its label. Records with a label that is not listed
+are left out.
+*/
+type CategoricalExtractor struct {
+	cells map[string]int32
+	label func(*gompcreader.MinorPlanet) string
+}
+
+func newCategoricalExtractor(labels []string, label func(*gompcreader.MinorPlanet) string) *CategoricalExtractor {
+	var result CategoricalExtractor
+	result.cells = make(map[string]int32)
+	for i, value := range labels {
+		result.cells[value] = int32(i)
+	}
+	result.label = label
+	return &result
+}
+
+/*
+ExtractCell for the label
+*/
+func (extractor *CategoricalExtractor) ExtractCell(in *gompcreader.MinorPlanet) int32 {
+	if cell, ok := extractor.cells[extractor.label(in)]; ok {
+		return cell
+	}
+	return -1
+}
+
+/*
+Extract the label
+*/
+func (extractor *CategoricalExtractor) Extract(in *gompcreader.MinorPlanet) string {
+	label := extractor.label(in)
+	if _, ok := extractor.cells[label]; ok {
+		return label
+	}
+	return ""
+}
+
+/*
+Flag is one bit of the MPCORB hex flags.
+*/
+type Flag struct {
+	Mask  uint64
+	Label string
+}
+
+/*
+mpcorbFlags are the flags decoded from the hex flags field. The low bits hold the orbit type, which the
+orbit class dimension covers.
+*/
+var mpcorbFlags = []Flag{
+	{0x0800, "neo"},
+	{0x1000, "1km-neo"},
+	{0x2000, "one-opposition"},
+	{0x4000, "critical-list"},
+	{0x8000, "pha"},
+}
+
+/*
+FlagsExtractor puts a record in the cell for every flag it has set, records with none of them set go in
+the last cell.
+*/
+type FlagsExtractor struct {
+	flags []Flag
+}
+
+/*
+ExtractCells for every flag set
+*/
+func (extractor *FlagsExtractor) ExtractCells(in *gompcreader.MinorPlanet, buffer []int32) []int32 {
+	value, err := strconv.ParseUint(strings.TrimSpace(in.HexFlags), 16, 64)
+	if err != nil {
+		return buffer
+	}
+	start := len(buffer)
+	for i, flag := range extractor.flags {
+		if value&flag.Mask != 0 {
+			buffer = append(buffer, int32(i))
+		}
+	}
+	if len(buffer) == start {
+		buffer = append(buffer, int32(len(extractor.flags)))
+	}
+	return buffer
+}
+
+/*
+ExtractCell gives the first flag set, use ExtractCells to get all of them.
+*/
+func (extractor *FlagsExtractor) ExtractCell(in *gompcreader.MinorPlanet) int32 {
+	cells := extractor.ExtractCells(in, nil)
+	if len(cells) == 0 {
+		return -1
+	}
+	return cells[0]
+}
+
+/*
+Extract the label of the first flag set
+*/
+func (extractor *FlagsExtractor) Extract(in *gompcreader.MinorPlanet) string {
+	cell := extractor.ExtractCell(in)
+	if cell < 0 {
+		return ""
+	}
+	return extractor.label(cell)
+}
+
+func (extractor *FlagsExtractor) label(cell int32) string {
+	if int(cell) == len(extractor.flags) {
+		return "none"
+	}
+	return extractor.flags[cell].Label
+}
+
+/*
+QuantileExtractor bins a value using cell edges picked from the data. Cell n runs from edges[n] up to
+edges[n+1], the last cell includes its top edge.
+*/
+type QuantileExtractor struct {
+	value  func(*gompcreader.MinorPlanet) float64
+	edges  []float64
+	format func(float64) string
+}
+
+/*
+ExtractCell for the value
+*/
+func (extractor *QuantileExtractor) ExtractCell(in *gompcreader.MinorPlanet) int32 {
+	value := extractor.value(in)
+	last := len(extractor.edges) - 1
+	if last < 1 || math.IsNaN(value) || value < extractor.edges[0] || value > extractor.edges[last] {
+		return -1
+	}
+	cell := sort.Search(last, func(i int) bool { return extractor.edges[i+1] > value })
+	if cell >= last {
+		cell = last - 1
+	}
+	return int32(cell)
+}
+
+/*
+Extract the lower edge of the value's cell
+*/
+func (extractor *QuantileExtractor) Extract(in *gompcreader.MinorPlanet) string {
+	cell := extractor.ExtractCell(in)
+	if cell < 0 {
+		return ""
+	}
+	if extractor.format == nil {
+		return strconv.FormatFloat(extractor.edges[cell], 'g', 4, 64)
+	}
+	return extractor.format(extractor.edges[cell])
+}
+
+/*
+LogExtractor bins a value into log spaced cells between minValue and maxValue, for values that cover
+several orders of magnitude. format turns the start of a cell into its label.
+*/
+type LogExtractor struct {
+	value    func(*gompcreader.MinorPlanet) float64
+	minValue float64
+	maxValue float64
+	gridSize int32
+	format   func(float64) string
+}
+
+/*
+ExtractCell for the value
+*/
+func (extractor *LogExtractor) ExtractCell(in *gompcreader.MinorPlanet) int32 {
+	value := extractor.value(in)
+	if math.IsNaN(value) || value < extractor.minValue || value > extractor.maxValue {
+		return -1
+	}
+	cell := int32(math.Log10(value/extractor.minValue) / extractor.stepSize())
+	if cell >= extractor.gridSize {
+		cell = extractor.gridSize - 1
+	}
+	return cell
+}
+
+/*
+Extract the start of the value's cell
+*/
+func (extractor *LogExtractor) Extract(in *gompcreader.MinorPlanet) string {
+	cell := extractor.ExtractCell(in)
+	if cell < 0 {
+		return ""
+	}
+	start := extractor.minValue * math.Pow(10, float64(cell)*extractor.stepSize())
+	if extractor.format == nil {
+		return strconv.FormatFloat(start, 'g', 3, 64)
+	}
+	return extractor.format(start)
+}
+
+func (extractor *LogExtractor) stepSize() float64 {
+	return math.Log10(extractor.maxValue/extractor.minValue) / float64(extractor.gridSize)
+}
+
+/*
+orbitalPeriod in years from Kepler's third law, the mass of the object is ignored. Unbound orbits have no period.
+*/
+func orbitalPeriod(in *gompcreader.MinorPlanet) float64 {
+	if in.SemimajorAxis <= 0 || in.OrbitalEccentricity >= 1 {
+		return math.NaN()
+	}
+	return math.Pow(in.SemimajorAxis, 1.5)
+}
+
+/*
+formatPeriod labels a period in years using days for short periods.
+*/
+func formatPeriod(years float64) string {
+	switch {
+	case years < 1:
+		return fmt.Sprintf("%.0f days", years*365.25)
+	case years < 100:
+		return fmt.Sprintf("%.1f years", years)
+	}
+	return fmt.Sprintf("%.0f years", years)
+}
+
+/*
+jupiterSemimajorAxis in AU, used for the Tisserand parameter.
+*/
+const jupiterSemimajorAxis = 5.2026
+
+/*
+tisserandJupiter is the Tisserand parameter of the orbit relative to Jupiter. It is worked out from q and e
+rather than a so parabolic and hyperbolic comets have one too.
+*/
+func tisserandJupiter(in *gompcreader.MinorPlanet) float64 {
+	q := perihelionDistance(in)
+	e := in.OrbitalEccentricity
+	if !(q > 0) || e < 0 {
+		return math.NaN()
+	}
+	cosI := math.Cos(in.InclinationToTheEcliptic * math.Pi / 180)
+	return jupiterSemimajorAxis*(1-e)/q + 2*cosI*math.Sqrt(q*(1+e)/jupiterSemimajorAxis)
+}
+
+/*
+jupiterMeanMotion is Jupiter's mean daily motion in degrees per day.
+*/
+const jupiterMeanMotion = 0.0830853
+
+/*
+meanMotionRatio is the object's mean motion over Jupiter's. Records without a mean daily motion work it out
+from the semi-major axis, open orbits have no mean motion.
+*/
+func meanMotionRatio(in *gompcreader.MinorPlanet) float64 {
+	if in.MeanDailyMotion > 0 {
+		return in.MeanDailyMotion / jupiterMeanMotion
+	}
+	if in.SemimajorAxis <= 0 || in.OrbitalEccentricity >= 1 {
+		return math.NaN()
+	}
+	return math.Pow(jupiterSemimajorAxis/in.SemimajorAxis, 1.5)
+}
+
+/*
+arcLength is the observed arc in days. Records that only have the years of the first and last observation
+use the whole years between them.
+*/
+func arcLength(in *gompcreader.MinorPlanet) float64 {
+	if in.ArcLength > 0 {
+		return float64(in.ArcLength)
+	}
+	if in.YearOfFirstObservation == 0 || in.YearOfLastObservation <= in.YearOfFirstObservation {
+		return math.NaN()
+	}
+	return float64(in.YearOfLastObservation-in.YearOfFirstObservation) * 365.25
+}
+
+/*
+formatDays labels a number of days, switching to years for long arcs.
+*/
+func formatDays(days float64) string {
+	if days < 365.25 {
+		return fmt.Sprintf("%.0f days", days)
+	}
+	return formatPeriod(days / 365.25)
+}
+
+/*
+formatCount labels a log cell of counts with the smallest whole count it can hold.
+*/
+func formatCount(count float64) string {
+	return fmt.Sprintf("%.0f", math.Ceil(count-1e-9))
+}
+
 func scaleAxis(in float64, maxValue float64, multiplier float64) int32 {
 	if in <= maxValue {
 		return int32(in * multiplier)
@@ -220,3 +688,80 @@ func round(f float64, places int) float64 {
 	shift := math.Pow(10, float64(places))
 	return math.Floor((f*shift)+.5) / shift
 }
+
+/*
+MonthExtractor bins a date, given as a decimal year by decimalYear, into calendar months starting in January
+of minYear.
+*/
+type MonthExtractor struct {
+	value    func(*gompcreader.MinorPlanet) float64
+	minYear  float64
+	gridSize int32
+}
+
+/*
+ExtractCell for the month
+*/
+func (extractor *MonthExtractor) ExtractCell(in *gompcreader.MinorPlanet) int32 {
+	value := extractor.value(in)
+	if math.IsNaN(value) {
+		return -1
+	}
+	cell := math.Floor((value - extractor.minYear) * 12)
+	if cell < 0 || cell >= float64(extractor.gridSize) {
+		return -1
+	}
+	return int32(cell)
+}
+
+/*
+Extract the month as YYYY-MM
+*/
+func (extractor *MonthExtractor) Extract(in *gompcreader.MinorPlanet) string {
+	cell := extractor.ExtractCell(in)
+	if cell < 0 {
+		return ""
+	}
+	return formatMonth(extractor.minYear + float64(cell)/12)
+}
+
+/*
+decimalYear turns a date into years where each month is a twelfth of a year whatever its length, so whole
+months always land in the same cell. The middle of the day is used to stay clear of the cell edges.
+*/
+func decimalYear(date time.Time) float64 {
+	if date.IsZero() {
+		return math.NaN()
+	}
+	days := time.Date(date.Year(), date.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	month := float64(date.Month()-1) + (float64(date.Day())-0.5)/float64(days)
+	return float64(date.Year()) + month/12
+}
+
+/*
+formatMonth labels a decimal year with its month.
+*/
+func formatMonth(year float64) string {
+	months := int(math.Floor(year*12 + 1e-6))
+	return fmt.Sprintf("%04d-%02d", months/12, months%12+1)
+}
+
+/*
+firstObservation is the date of the first observation, the date of the last observation less the arc in
+days. SBDB exports set the arc from their first_obs date so this is the real date. MPCORB only gives the
+arc in days for single opposition orbits, multi-opposition orbits only record the year so are missing.
+*/
+func firstObservation(in *gompcreader.MinorPlanet) float64 {
+	if in.ArcLength <= 0 || in.LastObservation.IsZero() {
+		return math.NaN()
+	}
+	return decimalYear(in.LastObservation.AddDate(0, 0, -int(in.ArcLength)))
+}
+
+func lastObservation(in *gompcreader.MinorPlanet) float64 {
+	return decimalYear(in.LastObservation)
+}
+
+func epochOfOsculation(in *gompcreader.MinorPlanet) float64 {
+	return decimalYear(in.Epoch)
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/wselwood/gompcreader"
@@ -190,3 +192,345 @@ func TestAbsoluteMagnitudeExtractor(t *testing.T) {
 		assert.Equal(t, tt.out, extractor.Extract(&input), "incorrect message %f %s", tt.in, tt.out)
 	}
 }
+
+type cometTestCase struct {
+	inSemimajorAxis       float64
+	inOrbitalEccentricity float64
+	out                   string
+	outCell               int32
+}
+
+var cometEccentricityTestCases = []cometTestCase{
+	{2.0, 0.5, "0.50", 50},
+	{2.0, 1.0, "parabolic", 100},
+	{-2.0, 1.5, "hyperbolic", 101},
+}
+
+func TestCometEccentricityExtractor(t *testing.T) {
+	extractor := CometEccentricityExtractor{}
+	for _, tt := range cometEccentricityTestCases {
+		var input gompcreader.MinorPlanet
+		input.SemimajorAxis = tt.inSemimajorAxis
+		input.OrbitalEccentricity = tt.inOrbitalEccentricity
+
+		assert.Equal(t, tt.outCell, extractor.ExtractCell(&input), "incorrect cell %f", tt.inOrbitalEccentricity)
+		assert.Equal(t, tt.out, extractor.Extract(&input), "incorrect message %f", tt.inOrbitalEccentricity)
+	}
+}
+
+var cometAphelionTestCases = []cometTestCase{
+	{2.0, 0.5, "3.0", 3},
+	{50.0, 0.99, "99.0", 99},
+	{2.0, 1.0, "unbound", 101},
+	{-2.0, 1.5, "unbound", 101},
+}
+
+func TestCometAphelionExtractor(t *testing.T) {
+	extractor := CometAphelionExtractor{100, 1.0, 101}
+	for _, tt := range cometAphelionTestCases {
+		var input gompcreader.MinorPlanet
+		input.SemimajorAxis = tt.inSemimajorAxis
+		input.OrbitalEccentricity = tt.inOrbitalEccentricity
+
+		assert.Equal(t, tt.outCell, extractor.ExtractCell(&input), "incorrect cell %f %f", tt.inSemimajorAxis, tt.inOrbitalEccentricity)
+		assert.Equal(t, tt.out, extractor.Extract(&input), "incorrect message %f %f", tt.inSemimajorAxis, tt.inOrbitalEccentricity)
+	}
+}
+
+// parabolic orbits keep q in place of the semi-major axis, hyperbolic ones have a negative semi-major axis
+var cometPerihelionTestCases = []cometTestCase{
+	{2.0, 0.5, "1.0", 10},
+	{2.0, 1.0, "2.0", 20},
+	{-2.0, 1.5, "1.0", 10},
+}
+
+func TestCometPerihelionExtractor(t *testing.T) {
+	extractor := CometPerihelionExtractor{10, 10.0}
+	for _, tt := range cometPerihelionTestCases {
+		var input gompcreader.MinorPlanet
+		input.SemimajorAxis = tt.inSemimajorAxis
+		input.OrbitalEccentricity = tt.inOrbitalEccentricity
+
+		assert.Equal(t, tt.outCell, extractor.ExtractCell(&input), "incorrect cell %f %f", tt.inSemimajorAxis, tt.inOrbitalEccentricity)
+		assert.Equal(t, tt.out, extractor.Extract(&input), "incorrect message %f %f", tt.inSemimajorAxis, tt.inOrbitalEccentricity)
+	}
+}
+
+type angleTestCase struct {
+	in      float64
+	out     string
+	outCell int32
+}
+
+var angleTestCases = []angleTestCase{
+	{0, "0.0", 0},
+	{4.99, "0.0", 0},
+	{5, "5.0", 1},
+	{359.99, "355.0", 71},
+	{360, "0.0", 0},
+	{725, "5.0", 1},
+	{-10, "350.0", 70},
+}
+
+func TestAngleExtractor(t *testing.T) {
+	extractor := AngleExtractor{dimensionFields["argument-of-perihelion"], 0, 72}
+	for _, tt := range angleTestCases {
+		var input gompcreader.MinorPlanet
+		input.ArgumentOfPerihelion = tt.in
+
+		assert.Equal(t, tt.outCell, extractor.ExtractCell(&input), "incorrect cell %f", tt.in)
+		assert.Equal(t, tt.out, extractor.Extract(&input), "incorrect message %f", tt.in)
+	}
+}
+
+func TestAngleExtractorOffset(t *testing.T) {
+	extractor := AngleExtractor{dimensionFields["ascending-node"], -180, 36}
+	var input gompcreader.MinorPlanet
+
+	input.LongitudeOfTheAscendingNode = 190
+	assert.Equal(t, int32(1), extractor.ExtractCell(&input))
+	assert.Equal(t, "-170.0", extractor.Extract(&input))
+
+	input.LongitudeOfTheAscendingNode = 175
+	assert.Equal(t, int32(35), extractor.ExtractCell(&input))
+}
+
+var orbitalPeriodTestCases = []cometTestCase{
+	{0.5, 0.1, "116 days", 5},
+	{1.0, 0.0, "1.0 years", 10},
+	{2.7676569, 0.0775571, "4.0 years", 16},
+	{5.2, 0.05, "10.0 years", 20},
+	{44, 0.05, "251 years", 34},
+	{2000, 0.9, "", -1},
+	{-2.0, 1.5, "", -1},
+}
+
+func TestOrbitalPeriodExtractor(t *testing.T) {
+	extractor := LogExtractor{orbitalPeriod, 0.1, 10000, 50, formatPeriod}
+	for _, tt := range orbitalPeriodTestCases {
+		var input gompcreader.MinorPlanet
+		input.SemimajorAxis = tt.inSemimajorAxis
+		input.OrbitalEccentricity = tt.inOrbitalEccentricity
+
+		assert.Equal(t, tt.outCell, extractor.ExtractCell(&input), "incorrect cell %f", tt.inSemimajorAxis)
+		assert.Equal(t, tt.out, extractor.Extract(&input), "incorrect message %f", tt.inSemimajorAxis)
+	}
+}
+
+type tisserandTestCase struct {
+	inSemimajorAxis       float64
+	inOrbitalEccentricity float64
+	inInclination         float64
+	out                   float64
+}
+
+var tisserandTestCases = []tisserandTestCase{
+	{5.2026, 0, 0, 3.0},
+	{2.7676569, 0.0775571, 10.58862, 3.309},
+	{17.834, 0.96714, 162.26, -0.605},
+	// parabolic orbits keep q in place of the semi-major axis
+	{1.0, 1.0, 0, 1.240},
+	{0, 0.5, 10, math.NaN()},
+}
+
+func TestTisserandJupiter(t *testing.T) {
+	for _, tt := range tisserandTestCases {
+		var input gompcreader.MinorPlanet
+		input.SemimajorAxis = tt.inSemimajorAxis
+		input.OrbitalEccentricity = tt.inOrbitalEccentricity
+		input.InclinationToTheEcliptic = tt.inInclination
+
+		if math.IsNaN(tt.out) {
+			assert.True(t, math.IsNaN(tisserandJupiter(&input)), "no value %f %f", tt.inSemimajorAxis, tt.inOrbitalEccentricity)
+			continue
+		}
+		assert.InDelta(t, tt.out, tisserandJupiter(&input), 0.001, "incorrect value %f %f", tt.inSemimajorAxis, tt.inOrbitalEccentricity)
+	}
+
+	borisov, err := parseCometLine(borisovLine)
+	assert.NoError(t, err)
+	assert.InDelta(t, -4.247, tisserandJupiter(borisov), 0.001, "hyperbolic")
+}
+
+type arcTestCase struct {
+	inArcLength int64
+	inFirstYear int64
+	inLastYear  int64
+	out         string
+	outCell     int32
+}
+
+var arcTestCases = []arcTestCase{
+	{12, 0, 0, "10 days", 10},
+	{0, 1801, 2019, "217 years", 49},
+	{0, 2010, 2012, "1.7 years", 28},
+	{0, 0, 0, "", -1},
+	{0, 2019, 2019, "", -1},
+}
+
+func TestArcLengthExtractor(t *testing.T) {
+	extractor := buildArcLength().Extractor
+	for _, tt := range arcTestCases {
+		var input gompcreader.MinorPlanet
+		input.ArcLength = tt.inArcLength
+		input.YearOfFirstObservation = tt.inFirstYear
+		input.YearOfLastObservation = tt.inLastYear
+
+		assert.Equal(t, tt.outCell, extractor.ExtractCell(&input), "incorrect cell %d %d %d", tt.inArcLength, tt.inFirstYear, tt.inLastYear)
+		assert.Equal(t, tt.out, extractor.Extract(&input), "incorrect message %d %d %d", tt.inArcLength, tt.inFirstYear, tt.inLastYear)
+	}
+}
+
+func TestNumberOfObservationsExtractor(t *testing.T) {
+	extractor := buildNumberOfObservations().Extractor
+	cases := []struct {
+		in      int64
+		out     string
+		outCell int32
+	}{
+		{0, "", -1},
+		{1, "1", 0},
+		{10, "10", 10},
+		{6751, "6310", 38},
+	}
+	for _, tt := range cases {
+		var input gompcreader.MinorPlanet
+		input.NumberOfObservations = tt.in
+
+		assert.Equal(t, tt.outCell, extractor.ExtractCell(&input), "incorrect cell %d", tt.in)
+		assert.Equal(t, tt.out, extractor.Extract(&input), "incorrect message %d", tt.in)
+	}
+}
+
+func TestNumberOfOppositionsExtractor(t *testing.T) {
+	extractor := buildNumberOfOppositions().Extractor
+	cases := []struct {
+		in      int64
+		out     string
+		outCell int32
+	}{
+		{0, "", -1},
+		{1, "1", 0},
+		{4, "4", 3},
+		{5, "5", 4},
+		{10, "10", 9},
+		{115, "115", 114},
+		{200, "", -1},
+	}
+	for _, tt := range cases {
+		var input gompcreader.MinorPlanet
+		input.NumberOfOppositions = tt.in
+
+		assert.Equal(t, tt.outCell, extractor.ExtractCell(&input), "incorrect cell %d", tt.in)
+		assert.Equal(t, tt.out, extractor.Extract(&input), "incorrect message %d", tt.in)
+	}
+}
+
+func TestUncertaintyExtractor(t *testing.T) {
+	extractor := buildUncertainty().Extractor
+	cases := []struct {
+		in      string
+		outCell int32
+	}{
+		{"0", 0},
+		{"9", 9},
+		{"E", 10},
+		{"D", 11},
+		{"F", 12},
+		{"", -1},
+		{"X", -1},
+	}
+	for _, tt := range cases {
+		var input gompcreader.MinorPlanet
+		input.UncertaintyParameter = tt.in
+
+		assert.Equal(t, tt.outCell, extractor.ExtractCell(&input), "incorrect cell %q", tt.in)
+	}
+}
+
+func TestFlagsExtractor(t *testing.T) {
+	extractor := FlagsExtractor{mpcorbFlags}
+	cases := []struct {
+		in       string
+		outCells []int32
+		out      string
+	}{
+		{"0000", []int32{5}, "none"},
+		{"0803", []int32{0}, "neo"},
+		{"9803", []int32{0, 1, 4}, "neo"},
+		{"2000", []int32{2}, "one-opposition"},
+		{"4000", []int32{3}, "critical-list"},
+		{"", nil, ""},
+	}
+	for _, tt := range cases {
+		var input gompcreader.MinorPlanet
+		input.HexFlags = tt.in
+
+		assert.Equal(t, tt.outCells, extractor.ExtractCells(&input, nil), "incorrect cells %q", tt.in)
+		assert.Equal(t, tt.out, extractor.Extract(&input), "incorrect message %q", tt.in)
+	}
+}
+
+func TestMonthExtractors(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	months, err := BuildConfiguredDimensions([]DimensionConfig{
+		{Name: "First-Observation-Month", Field: "first-observation", Min: 1995, Max: 2030, Binning: "month"},
+		{Name: "Last-Observation-Month", Field: "last-observation", Min: 1995, Max: 2030, Binning: "month"},
+		{Name: "Epoch", Field: "epoch", Min: 1995, Max: 2030, Binning: "month"},
+	}, DefaultAlbedo())
+	assert.NoError(t, err)
+	firstMonth, lastMonth, epoch := months[0], months[1], months[2]
+	cases := []struct {
+		dimension Dimension
+		arc       int64
+		last      time.Time
+		epoch     time.Time
+		out       string
+		outCell   int32
+	}{
+		{firstMonth, 40, date(2015, time.March, 10), time.Time{}, "2015-01", 240},
+		{firstMonth, 0, date(2015, time.March, 10), time.Time{}, "", -1},
+		{lastMonth, 0, date(1995, time.December, 31), time.Time{}, "1995-12", 11},
+		{lastMonth, 0, date(2030, time.January, 1), time.Time{}, "", -1},
+		{lastMonth, 0, time.Time{}, time.Time{}, "", -1},
+		{epoch, 0, time.Time{}, date(2024, time.October, 17), "2024-10", 357},
+	}
+	for _, tt := range cases {
+		var input gompcreader.MinorPlanet
+		input.ArcLength = tt.arc
+		input.LastObservation = tt.last
+		input.Epoch = tt.epoch
+
+		assert.Equal(t, tt.outCell, tt.dimension.Extractor.ExtractCell(&input), "incorrect cell %s %v", tt.dimension.Name, tt.last)
+		assert.Equal(t, tt.out, tt.dimension.Extractor.Extract(&input), "incorrect message %s %v", tt.dimension.Name, tt.last)
+	}
+}
+
+func TestMeanMotionRatio(t *testing.T) {
+	cases := []struct {
+		inMeanDailyMotion float64
+		inSemimajorAxis   float64
+		inEccentricity    float64
+		out               float64
+	}{
+		{0.0830853, 0, 0, 1},
+		{0.2492559, 2.5, 0.1, 3},
+		{0, 5.2026, 0.1, 1},
+		{0, 5.2026 / math.Pow(2, 2.0/3), 0.1, 2},
+	}
+	for _, tt := range cases {
+		var input gompcreader.MinorPlanet
+		input.MeanDailyMotion = tt.inMeanDailyMotion
+		input.SemimajorAxis = tt.inSemimajorAxis
+		input.OrbitalEccentricity = tt.inEccentricity
+
+		assert.InDelta(t, tt.out, meanMotionRatio(&input), 1e-6, "incorrect ratio %f %f", tt.inMeanDailyMotion, tt.inSemimajorAxis)
+	}
+
+	var open gompcreader.MinorPlanet
+	open.SemimajorAxis = 10
+	open.OrbitalEccentricity = 1.2
+	assert.True(t, math.IsNaN(meanMotionRatio(&open)), "open orbits have no mean motion")
+}
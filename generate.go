@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wselwood/gompcreader"
+)
+
+/*
+Gap is a region of semi-major axis that a population avoids, e.g. a Kirkwood gap.
+*/
+type Gap struct {
+	Center float64 `json:"center"`
+	Width  float64 `json:"width"`
+}
+
+/*
+Population describes how to draw the orbits of one group of synthetic objects.
+Eccentricity is normally distributed, inclination follows a Rayleigh distribution and H follows
+a power law where the number of objects brighter than H grows as 10^(HSlope*H).
+*/
+type Population struct {
+	Name              string  `json:"name"`
+	Weight            float64 `json:"weight"`
+	MinA              float64 `json:"minA"`
+	MaxA              float64 `json:"maxA"`
+	Gaps              []Gap   `json:"gaps,omitempty"`
+	EccentricityMean  float64 `json:"eMean"`
+	EccentricitySigma float64 `json:"eSigma"`
+	InclinationSigma  float64 `json:"iSigma"`
+	MaxPerihelion     float64 `json:"maxQ,omitempty"`
+	MinH              float64 `json:"minH"`
+	MaxH              float64 `json:"maxH"`
+	HSlope            float64 `json:"hSlope"`
+	HexFlags          int     `json:"flags,omitempty"`
+}
+
+/*
+DefaultPopulations returns a rough model of the known minor planets: a main belt with the
+Kirkwood gaps cleared out, near earth objects, Jupiter Trojans and trans-Neptunian objects.
+*/
+func DefaultPopulations() []Population {
+	return []Population{
+		{
+			Name: "main-belt", Weight: 0.90, MinA: 2.0, MaxA: 3.3,
+			Gaps: []Gap{
+				{2.065, 0.02},  // 4:1
+				{2.502, 0.02},  // 3:1
+				{2.825, 0.02},  // 5:2
+				{2.958, 0.015}, // 7:3
+				{3.279, 0.02},  // 2:1
+			},
+			EccentricityMean: 0.14, EccentricitySigma: 0.07, InclinationSigma: 6,
+			MinH: 11, MaxH: 19, HSlope: 0.3,
+		},
+		{
+			Name: "neo", Weight: 0.03, MinA: 0.6, MaxA: 4.0,
+			EccentricityMean: 0.45, EccentricitySigma: 0.2, InclinationSigma: 12, MaxPerihelion: 1.3,
+			MinH: 14, MaxH: 25, HSlope: 0.3,
+		},
+		{
+			Name: "trojan", Weight: 0.05, MinA: 5.15, MaxA: 5.25,
+			EccentricityMean: 0.07, EccentricitySigma: 0.04, InclinationSigma: 12,
+			MinH: 9, MaxH: 16, HSlope: 0.3,
+		},
+		{
+			Name: "tno", Weight: 0.02, MinA: 34, MaxA: 60,
+			EccentricityMean: 0.1, EccentricitySigma: 0.08, InclinationSigma: 10,
+			MinH: 4, MaxH: 9, HSlope: 0.5,
+		},
+	}
+}
+
+const maxGenerateAttempts = 1000
+
+/*
+Generator draws synthetic minor planets from a set of populations.
+*/
+type Generator struct {
+	random      *rand.Rand
+	populations []Population
+	totalWeight float64
+	epoch       time.Time
+	count       int
+}
+
+/*
+NewGenerator creates a generator. The same seed and populations always give the same objects.
+*/
+func NewGenerator(seed int64, populations []Population) (*Generator, error) {
+	var result Generator
+	result.random = rand.New(rand.NewSource(seed))
+	result.populations = populations
+	result.epoch = time.Date(2025, time.May, 5, 0, 0, 0, 0, time.UTC)
+
+	for _, population := range populations {
+		if population.Weight < 0 || population.MinA <= 0 || population.MaxA < population.MinA || population.MaxH < population.MinH {
+			return nil, fmt.Errorf("population %s is not valid", population.Name)
+		}
+		result.totalWeight = result.totalWeight + population.Weight
+	}
+	if result.totalWeight <= 0 {
+		return nil, fmt.Errorf("no populations to generate from")
+	}
+	return &result, nil
+}
+
+/*
+Next creates the next synthetic object.
+*/
+func (generator *Generator) Next() (*gompcreader.MinorPlanet, error) {
+	population := generator.pickPopulation()
+
+	var result gompcreader.MinorPlanet
+	generator.count = generator.count + 1
+	id, err := packNumber(generator.count)
+	if err != nil {
+		return nil, err
+	}
+	result.ID = id
+	result.ReadableDesignation = fmt.Sprintf("(%d) Synthetic %s", generator.count, population.Name)
+
+	a, e, err := generator.drawOrbit(population)
+	if err != nil {
+		return nil, err
+	}
+	result.SemimajorAxis = a
+	result.OrbitalEccentricity = e
+	result.MeanDailyMotion = 0.9856076686 / math.Pow(a, 1.5)
+	result.InclinationToTheEcliptic = math.Min(generator.rayleigh(population.InclinationSigma), 179.9)
+	result.MeanAnomalyEpoch = generator.random.Float64() * 360
+	result.ArgumentOfPerihelion = generator.random.Float64() * 360
+	result.LongitudeOfTheAscendingNode = generator.random.Float64() * 360
+	result.AbsoluteMagnitude = generator.powerLaw(population.MinH, population.MaxH, population.HSlope)
+	result.Slope = 0.15
+	result.Epoch = generator.epoch
+
+	first := 1990 + generator.random.Intn(35)
+	last := first + generator.random.Intn(2025-first+1)
+	result.YearOfFirstObservation = int64(first)
+	result.YearOfLastObservation = int64(last)
+	result.NumberOfOppositions = int64(last - first + 1)
+	result.NumberOfObservations = result.NumberOfOppositions * int64(5+generator.random.Intn(40))
+	result.LastObservation = time.Date(last, time.Month(1+generator.random.Intn(12)), 1+generator.random.Intn(28), 0, 0, 0, 0, time.UTC)
+	result.UncertaintyParameter = strconv.Itoa(generator.random.Intn(10))
+	result.RmsResidual = 0.3 + generator.random.Float64()*0.5
+	result.Reference = "SYNTH"
+	result.ComputerName = "astro-grid"
+	flags := population.HexFlags
+	if orbitType := neoOrbitType(a, e); orbitType != 0 {
+		flags = flags | orbitType | 0x0800
+	}
+	result.HexFlags = fmt.Sprintf("%04X", flags)
+
+	return &result, nil
+}
+
+func (generator *Generator) pickPopulation() Population {
+	pick := generator.random.Float64() * generator.totalWeight
+	for _, population := range generator.populations {
+		pick = pick - population.Weight
+		if pick < 0 {
+			return population
+		}
+	}
+	return generator.populations[len(generator.populations)-1]
+}
+
+/*
+drawOrbit picks a semi-major axis and eccentricity, redrawing while the orbit falls in a gap or
+breaks the perihelion limit.
+*/
+func (generator *Generator) drawOrbit(population Population) (float64, float64, error) {
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		a := population.MinA + generator.random.Float64()*(population.MaxA-population.MinA)
+		e := population.EccentricityMean + generator.random.NormFloat64()*population.EccentricitySigma
+		if e < 0 || e >= 0.99 || inGap(a, population.Gaps) {
+			continue
+		}
+		if population.MaxPerihelion > 0 && a*(1-e) > population.MaxPerihelion {
+			continue
+		}
+		return a, e, nil
+	}
+	return 0, 0, fmt.Errorf("could not draw an orbit for population %s after %d attempts", population.Name, maxGenerateAttempts)
+}
+
+func inGap(a float64, gaps []Gap) bool {
+	for _, gap := range gaps {
+		if math.Abs(a-gap.Center) < gap.Width/2 {
+			return true
+		}
+	}
+	return false
+}
+
+func (generator *Generator) rayleigh(sigma float64) float64 {
+	return sigma * math.Sqrt(-2*math.Log(1-generator.random.Float64()))
+}
+
+/*
+powerLaw draws from min to max where the number of values below x grows as 10^(slope*x).
+*/
+func (generator *Generator) powerLaw(min float64, max float64, slope float64) float64 {
+	u := generator.random.Float64()
+	if slope == 0 {
+		return min + u*(max-min)
+	}
+	low := math.Pow(10, slope*min)
+	high := math.Pow(10, slope*max)
+	return math.Log10(low+u*(high-low)) / slope
+}
+
+/*
+neoOrbitType gives the MPC orbit type code for near earth orbits, 1 Atira, 2 Aten, 3 Apollo, 4 Amor.
+Everything else is 0. Anything with a type also gets the NEO flag.
+*/
+func neoOrbitType(a float64, e float64) int {
+	q := a * (1 - e)
+	Q := a * (1 + e)
+	switch {
+	case a < 1 && Q < 0.983:
+		return 1
+	case a < 1:
+		return 2
+	case q < 1.017:
+		return 3
+	case q < 1.3:
+		return 4
+	}
+	return 0
+}
+
+/*
+parseMix reads population weights in the form name=weight,name=weight and applies them.
+Populations not mentioned are dropped.
+*/
+func parseMix(mix string, populations []Population) ([]Population, error) {
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(mix, ",") {
+		pieces := strings.SplitN(part, "=", 2)
+		if len(pieces) != 2 {
+			return nil, fmt.Errorf("invalid mix entry %q, expected name=weight", part)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(pieces[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight in mix entry %q", part)
+		}
+		weights[strings.TrimSpace(pieces[0])] = weight
+	}
+
+	var result []Population
+	for _, population := range populations {
+		if weight, ok := weights[population.Name]; ok {
+			population.Weight = weight
+			result = append(result, population)
+			delete(weights, population.Name)
+		}
+	}
+	if len(weights) > 0 {
+		var unknown []string
+		for name := range weights {
+			unknown = append(unknown, name)
+		}
+		return nil, fmt.Errorf("unknown populations in mix: %s", strings.Join(unknown, ", "))
+	}
+	return result, nil
+}
+
+func loadPopulations(path string) ([]Population, error) {
+	data, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+
+	var result []Population
+	if err := json.NewDecoder(data).Decode(&result); err != nil {
+		return nil, fmt.Errorf("could not read populations from %s: %v", path, err)
+	}
+	return result, nil
+}
+
+/*
+runGenerate implements the generate command which writes synthetic MPCORB records.
+*/
+func runGenerate(args []string) {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	count := flags.Int("n", 10000, "the number of objects to generate")
+	seed := flags.Int64("seed", 1, "the random seed, the same seed gives the same output")
+	out := flags.String("out", "-", "the file to write, gzipped if it ends in .gz. Defaults to stdout")
+	mix := flags.String("mix", "", "population weights, e.g. main-belt=0.9,neo=0.03,trojan=0.05,tno=0.02")
+	config := flags.String("populations", "", "a json file of population definitions to use instead of the defaults")
+	flags.Parse(args)
+
+	populations := DefaultPopulations()
+	if *config != "" {
+		loaded, err := loadPopulations(*config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		populations = loaded
+	}
+	if *mix != "" {
+		mixed, err := parseMix(*mix, populations)
+		if err != nil {
+			log.Fatal(err)
+		}
+		populations = mixed
+	}
+
+	generator, err := NewGenerator(*seed, populations)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var output io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal("Error opening output file ", err)
+		}
+		defer f.Close()
+		output = f
+
+		if strings.HasSuffix(*out, ".gz") {
+			gz := gzip.NewWriter(f)
+			defer gz.Close()
+			output = gz
+		}
+	}
+
+	buffered := bufio.NewWriter(output)
+	defer buffered.Flush()
+	if err := WriteSynthetic(buffered, generator, *count); err != nil {
+		log.Fatal(err)
+	}
+}
+
+/*
+WriteSynthetic writes count records from the generator as MPCORB lines.
+*/
+func WriteSynthetic(out io.Writer, generator *Generator, count int) error {
+	for i := 0; i < count; i++ {
+		planet, err := generator.Next()
+		if err != nil {
+			return err
+		}
+		line, err := formatMpcorbLine(planet)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(out, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneratorRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astro-grid")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "synthetic.dat.gz")
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	generator, err := NewGenerator(42, DefaultPopulations())
+	assert.NoError(t, err)
+	assert.NoError(t, WriteSynthetic(gz, generator, 2000))
+	assert.NoError(t, gz.Close())
+	assert.NoError(t, f.Close())
+
+	reader, err := NewGompcreaderSource(path)
+	assert.NoError(t, err)
+	defer reader.Close()
+	records := readAll(t, reader)
+	assert.Len(t, records, 2000)
+
+	expected, _ := NewGenerator(42, DefaultPopulations())
+	dimensions := BuildDimensions(DefaultAlbedo())
+	for _, record := range records {
+		want, err := expected.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, want.ID, record.ID)
+		assert.Equal(t, want.ReadableDesignation, record.ReadableDesignation)
+		assert.InDelta(t, want.AbsoluteMagnitude, record.AbsoluteMagnitude, 0.005, want.ID)
+		assert.InDelta(t, want.SemimajorAxis, record.SemimajorAxis, 0.0000001, want.ID)
+		assert.InDelta(t, want.OrbitalEccentricity, record.OrbitalEccentricity, 0.0000001, want.ID)
+		assert.InDelta(t, want.InclinationToTheEcliptic, record.InclinationToTheEcliptic, 0.00001, want.ID)
+		assert.InDelta(t, want.MeanDailyMotion, record.MeanDailyMotion, 0.00000001, want.ID)
+		assert.Equal(t, want.NumberOfObservations, record.NumberOfObservations, want.ID)
+		assert.Equal(t, want.NumberOfOppositions, record.NumberOfOppositions, want.ID)
+		assert.Equal(t, want.YearOfFirstObservation, record.YearOfFirstObservation, want.ID)
+		assert.Equal(t, want.YearOfLastObservation, record.YearOfLastObservation, want.ID)
+		assert.Equal(t, want.HexFlags, record.HexFlags, want.ID)
+
+		for _, dimension := range dimensions {
+			dimension.Extractor.ExtractCell(record)
+			dimension.Extractor.Extract(record)
+		}
+		for _, gap := range DefaultPopulations()[0].Gaps {
+			if record.SemimajorAxis < 2.0 || record.SemimajorAxis > 3.3 {
+				continue
+			}
+			assert.False(t, gap.Center-gap.Width/2 < record.SemimajorAxis && record.SemimajorAxis < gap.Center+gap.Width/2,
+				"%s is in the %f gap", record.ID, gap.Center)
+		}
+	}
+}
+
+func TestGeneratorIsRepeatable(t *testing.T) {
+	var first, second bytes.Buffer
+	a, _ := NewGenerator(7, DefaultPopulations())
+	b, _ := NewGenerator(7, DefaultPopulations())
+	assert.NoError(t, WriteSynthetic(&first, a, 100))
+	assert.NoError(t, WriteSynthetic(&second, b, 100))
+	assert.Equal(t, first.String(), second.String())
+
+	var other bytes.Buffer
+	c, _ := NewGenerator(8, DefaultPopulations())
+	assert.NoError(t, WriteSynthetic(&other, c, 100))
+	assert.False(t, first.String() == other.String(), "different seeds give different data")
+}
+
+func TestParseMix(t *testing.T) {
+	populations, err := parseMix("neo=1,tno=0.5", DefaultPopulations())
+	assert.NoError(t, err)
+	assert.Len(t, populations, 2)
+	assert.Equal(t, "neo", populations[0].Name)
+	assert.Equal(t, 0.5, populations[1].Weight)
+
+	_, err = parseMix("comets=1", DefaultPopulations())
+	assert.Error(t, err)
+}
+
+func TestPackNumber(t *testing.T) {
+	packed, err := packNumber(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "00001", packed)
+
+	packed, err = packNumber(123456)
+	assert.NoError(t, err)
+	assert.Equal(t, "C3456", packed)
+
+	_, err = packNumber(620000)
+	assert.Error(t, err)
+}
+
+func TestFormatMpcorbLine(t *testing.T) {
+	ceres, err := parseMpcorbLine(ceresLine)
+	assert.NoError(t, err)
+
+	line, err := formatMpcorbLine(ceres)
+	assert.NoError(t, err)
+	assert.Equal(t, ceresLine, line)
+	assert.True(t, strings.HasSuffix(line, "20190915"))
+
+	single, err := parseMpcorbLine(singleOppositionLine)
+	assert.NoError(t, err)
+	line, err = formatMpcorbLine(single)
+	assert.NoError(t, err)
+	assert.Equal(t, singleOppositionLine[166:194], line[166:194], "readable designation columns")
+}
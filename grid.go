@@ -36,14 +36,14 @@ func BuildGrid(sizeX int, sizeY int) Grid {
 }
 
 /*
-BuildResultsGrid builds a results grid
+BuildResultsGrid builds a results grid, each dimension has its excluded cells after the normal ones
 */
 func BuildResultsGrid(dimentions []Dimension) [][]Grid {
-	resultTable := make([][]Grid, NumDimentions)
-	for i := 0; i < NumDimentions; i++ {
-		resultTable[i] = make([]Grid, NumDimentions)
-		for j := 0; j < NumDimentions; j++ {
-			resultTable[i][j] = BuildGrid(dimentions[i].GridSize, dimentions[j].GridSize)
+	resultTable := make([][]Grid, len(dimentions))
+	for i := 0; i < len(dimentions); i++ {
+		resultTable[i] = make([]Grid, len(dimentions))
+		for j := 0; j < len(dimentions); j++ {
+			resultTable[i][j] = BuildGrid(dimentions[i].GridSize+excludedCells, dimentions[j].GridSize+excludedCells)
 		}
 	}
 	return resultTable
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+)
+
+/*
+StdinPath is the input path that means read from standard in rather than a file.
+*/
+const StdinPath = "-"
+
+var gzipMagic = []byte{0x1f, 0x8b}
+var bzip2Magic = []byte("BZh")
+
+/*
+inputStream wraps a possibly decompressed reader so closing it also closes the underlying file.
+*/
+type inputStream struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (stream *inputStream) Close() error {
+	var result error
+	for i := len(stream.closers) - 1; i >= 0; i-- {
+		if err := stream.closers[i].Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+/*
+OpenInput opens the path given, or standard in for "-", and transparently decompresses it.
+The compression is detected from the magic bytes at the start of the stream so gzip
+(including concatenated gzip members), bzip2 and plain text inputs are all handled.
+*/
+func OpenInput(path string) (io.ReadCloser, error) {
+	var raw io.ReadCloser
+	if path == StdinPath {
+		raw = os.Stdin
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		raw = f
+	}
+
+	stream, err := decompress(raw)
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+	return stream, nil
+}
+
+func decompress(raw io.ReadCloser) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(raw)
+	magic, err := buffered.Peek(3)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(magic, gzipMagic) {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		return &inputStream{gz, []io.Closer{raw, gz}}, nil
+	}
+
+	if bytes.HasPrefix(magic, bzip2Magic) {
+		return &inputStream{bzip2.NewReader(buffered), []io.Closer{raw}}, nil
+	}
+
+	return &inputStream{buffered, []io.Closer{raw}}, nil
+}
+
+/*
+lineReader is the shared part of the readers for the line based formats. It skips blank lines, and any
+line skip says the format does not use, and hands the rest to a parse func. A line parse fails on comes
+back as a ParseError with the line number so a tolerant run can carry on to the next one.
+*/
+type lineReader struct {
+	input   io.ReadCloser
+	name    string
+	format  string
+	scanner *bufio.Scanner
+	line    int64
+	skip    func(string) bool
+}
+
+func newLineReader(input io.ReadCloser, format string) lineReader {
+	var result lineReader
+	result.input = input
+	result.format = format
+	result.scanner = bufio.NewScanner(input)
+	return result
+}
+
+/*
+read passes the next line to parse, or returns io.EOF when there are no more.
+*/
+func (reader *lineReader) read(parse func(string) error) error {
+	for reader.scanner.Scan() {
+		reader.line = reader.line + 1
+		line := reader.scanner.Text()
+		if reader.skip != nil && reader.skip(line) {
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if err := parse(line); err != nil {
+			return &ParseError{reader.Source(), line, err.Error()}
+		}
+		return nil
+	}
+
+	if err := reader.scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+/*
+Close closes the underlying stream.
+*/
+func (reader *lineReader) Close() error {
+	return reader.input.Close()
+}
+
+/*
+Source describes the file being read and the line of the last record.
+*/
+func (reader *lineReader) Source() SourceInfo {
+	return SourceInfo{reader.name, reader.format, reader.line}
+}
@@ -4,26 +4,36 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
 	"syscall"
-
-	"github.com/wselwood/gompcreader"
 )
 
-var inputfile = flag.String("in", "", "the minor planet center file to read")
+var inputfile = flag.String("in", "", "the minor planet center file to read, gzip, bzip2 or plain text. Use - to read from stdin. Several files or globs can be given separated by commas")
+var inputFormat = flag.String("format", "mpcorb", "the format of the input file, mpcorb, sbdb (JPL Small-Body Database csv export) or astorb (Lowell astorb.dat) or comet (MPC CometEls.txt) or obs80 (MPC 80 column observations, builds observation grids)")
+var duplicates = flag.String("duplicates", "first", "which record to keep when a designation appears more than once: first, newest (epoch) or most-observations. newest and most-observations read the input twice so can not be used with stdin")
+var tolerant = flag.Bool("tolerant", false, "skip records that can not be parsed, writing them to rejects.txt in the output path")
+var maxErrors = flag.Int64("max-errors", 1000, "give up once this many records have been rejected. 0 for no limit. Only used with -tolerant, without it the first bad record stops the run")
+var dimensionsFile = flag.String("dimensions", "", "a json or yaml file defining the dimensions to use instead of the built in ones")
+var albedo = flag.Float64("albedo", 0.14, "the albedo assumed when estimating diameters")
+var albedoClasses = flag.String("albedo-classes", "", "albedos for particular orbit classes, e.g. tno=0.09,trojan=0.07")
+var autoRange = flag.Bool("auto-range", false, "pick the range of the numeric dimensions from the input rather than using the built in ones")
+var autoRangeSample = flag.Int64("auto-range-sample", 0, "with -auto-range the number of records to pick at random from the input, 0 for all of them")
+var autoRangeClip = flag.Float64("auto-range-clip", 0.5, "with -auto-range the percentage of values to ignore at each end of the range")
+var quantileClip = flag.Float64("quantile-clip", 0, "the percentage of values to leave out at each end when picking quantile edges")
+var autoRangeBins = flag.Int("auto-range-bins", 100, "with -auto-range the number of cells to aim for in each dimension")
+var quantileBinning = flag.Bool("quantile", false, "use quantile binning for the numeric dimensions so each cell holds about the same number of objects")
+var snapshotDir = flag.String("snapshots", "", "a directory of dated catalogue files, e.g. MPCORB-2015-07.DAT.gz. Grids are built for each date in its own folder")
 var outputDir = flag.String("out", "", "the output path to write the structure")
 var debugMode = flag.Bool("debug", false, "add flag if you want extra debug logging. This has a big performance impact.")
 var forceClean = flag.Bool("force", false, "force clean output directory if it contains data")
 
-func outputGrid(dimentions []Dimension, resultTable [][]Grid) {
-	for i := 0; i < NumDimentions; i++ {
-		for j := 0; j < NumDimentions; j++ {
-			path := fmt.Sprintf("%s/%s/%s/", *outputDir, dimentions[i].Name, dimentions[j].Name)
+func outputGrid(outputDir string, dimentions []Dimension, resultTable [][]Grid) {
+	for i := 0; i < len(dimentions); i++ {
+		for j := 0; j < len(dimentions); j++ {
+			path := fmt.Sprintf("%s/%s/%s/", outputDir, dimentions[i].Name, dimentions[j].Name)
 			os.MkdirAll(path, 0777)
 
 			f, err := os.Create(fmt.Sprintf("%s/data.json", path))
@@ -60,10 +70,6 @@ func outputGrid(dimentions []Dimension, resultTable [][]Grid) {
 	}
 }
 
-func openOrCreateFile(path string) (*os.File, error) {
-	return os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0666)
-}
-
 func pathIsDir(path string) (bool, error) {
 	pathStat, err := os.Stat(path)
 	if err != nil && os.IsNotExist(err) {
@@ -86,16 +92,51 @@ func dirContainsFiles(path string) (bool, error) {
 
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "generate" {
+		runGenerate(os.Args[2:])
+		return
+	}
+
 	flag.Parse()
 
-	if *inputfile == "" {
-		log.Fatal("No input file provided. Use the -in /path/to/file")
+	if *inputfile == "" && *snapshotDir == "" {
+		log.Fatal("No input file provided. Use the -in /path/to/file or -in - for stdin")
+	} else if *inputfile != "" && *snapshotDir != "" {
+		log.Fatal("Use either -in or -snapshots, not both")
 	}
 
 	if *outputDir == "" {
 		log.Fatal("No output path provided Use -out /output/path")
 	}
 
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "max-errors" && !*tolerant {
+			log.Fatal("-max-errors only applies with -tolerant")
+		}
+	})
+
+	duplicatePolicy, err := ParseDuplicatePolicy(*duplicates)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	albedoModel, err := ParseAlbedo(*albedo, *albedoClasses)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var dimentions []Dimension
+	if *dimensionsFile != "" {
+		dimentions, err = LoadDimensions(*dimensionsFile, albedoModel)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *inputFormat == "comet" {
+		dimentions = BuildCometDimensions()
+	} else {
+		dimentions = BuildDimensions(albedoModel)
+	}
+
 	exists, err := pathIsDir(*outputDir)
 	if err != nil {
 		log.Fatal("Could not check output path existance")
@@ -127,97 +168,163 @@ func main() {
 		syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rLimit)
 	}
 
-	mpcReader, err := gompcreader.NewMpcReader(*inputfile)
-	if err != nil {
-		log.Fatal("error creating mpcReader ", err)
+	if *inputFormat == "obs80" {
+		if *snapshotDir != "" {
+			log.Fatal("Snapshots are not supported for observation files")
+		}
+		paths, err := expandInputs(*inputfile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var rejects *RejectsReport
+		if *tolerant {
+			rejects, err = NewRejectsReport(filepath.Join(*outputDir, "rejects.txt"), *maxErrors)
+			if err != nil {
+				log.Fatal("error creating rejects report ", err)
+			}
+		}
+		run, _, err := ProcessObservations(paths, *outputDir, rejects)
+		if rejects != nil {
+			rejects.Close()
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%d observations\n", run.Records)
+		if rejects != nil {
+			fmt.Printf("rejected: %d\n", rejects.Count())
+		}
+		return
 	}
-	defer mpcReader.Close()
 
-	var dimentions = BuildDimensions()
-	var resultTable = BuildResultsGrid(dimentions[:])
+	if *snapshotDir == "" {
+		paths, err := expandInputs(*inputfile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if needsFitting(dimentions) {
+			dimentions, err = autoRangeFrom(paths, dimentions)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if _, err := buildGrids(paths, *outputDir, dimentions, duplicatePolicy); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	var count int64
-	var flushCount int64
+	snapshots, skipped, err := FindSnapshots(*snapshotDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, name := range skipped {
+		fmt.Printf("skipping %s, no date in the file name\n", name)
+	}
 
-	drilldowns := make(map[string]string)
+	if needsFitting(dimentions) {
+		// every snapshot shares the ranges of the latest one so they can be compared
+		dimentions, err = autoRangeFrom(snapshots[len(snapshots)-1].Files, dimentions)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	result, err := mpcReader.ReadEntry()
-	for err == nil {
+	for i := range snapshots {
+		fmt.Printf("snapshot %s\n", snapshots[i].Date)
+		snapshotOut := filepath.Join(*outputDir, snapshots[i].Date)
+		os.MkdirAll(snapshotOut, 0777)
 
-		for i := 0; i < NumDimentions; i++ {
-			x := dimentions[i].Extractor.ExtractCell(result)
-			if x > 0 {
-				for j := 0; j < NumDimentions; j++ {
-					y := dimentions[j].Extractor.ExtractCell(result)
-					if y > 0 {
-						grid := resultTable[i][j].G
-						if *debugMode {
-							fmt.Printf("i:%2d, j:%2d, x:%3d, y:%3d, c:%d\n", i, j, x, y, count)
-						}
-						grid[x][y].Count = grid[x][y].Count + 1
+		run, err := buildGrids(snapshots[i].Files, snapshotOut, dimentions, duplicatePolicy)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("snapshot %s: ", snapshots[i].Date), err)
+		}
+		snapshots[i].Records = run.Records
+		snapshots[i].Duplicates = run.Duplicates
+		snapshots[i].Rejected = run.Rejected
+	}
 
-						if grid[x][y].X == 0 {
-							grid[x][y].X = int(x)
-							grid[x][y].Y = int(y)
-							grid[x][y].StartX = dimentions[i].Extractor.Extract(result)
-							grid[x][y].StartY = dimentions[j].Extractor.Extract(result)
-						}
-						drillDownPath := fmt.Sprintf("%s/%s/%s/%d/%d.txt", *outputDir, dimentions[i].Name, dimentions[j].Name, x, y)
-						v, k := drilldowns[drillDownPath]
-						if !k {
-							v = "id\n"
-						}
-						drilldowns[drillDownPath] = v + result.ID + "\n"
+	RenderDimensions(*outputDir, dimentions)
+	RenderSnapshotIndex(*outputDir, snapshots)
+}
 
-					}
-				}
-			}
+/*
+autoRangeFrom samples the input to pick the ranges or quantile edges of the dimensions. The input is read
+again to build the grids so this does not work with stdin.
+*/
+func autoRangeFrom(paths []string, dimentions []Dimension) ([]Dimension, error) {
+	for _, path := range paths {
+		if path == StdinPath {
+			return nil, fmt.Errorf("-auto-range and quantile binning read the input twice so can not be used with stdin")
 		}
+	}
 
-		// flush what we have so far to keep our memory useage to a reasonable level.
-		if count%10000 == 0 {
-			flushCount = flushCount + 1
-			for k, v := range drilldowns {
-				// only try and create the folders if we know it is new.
-				if strings.HasPrefix(v, "id\n") {
-					os.MkdirAll(filepath.Dir(k), 0777)
-				}
-
-				f, err := openOrCreateFile(k)
-				if err != nil {
-					log.Fatal(err)
-				}
-				f.WriteString(strings.TrimRight(v, "\n"))
-				f.Close()
+	source, err := OpenInputs(*inputFormat, paths, FirstWins, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error opening input for auto range %v", err)
+	}
+	defer source.Close()
+
+	var options AutoRangeOptions
+	options.Sample = *autoRangeSample
+	options.Clip = *autoRangeClip
+	options.QuantileClip = *quantileClip
+	options.Bins = *autoRangeBins
+	options.Ranges = *autoRange
+	options.Quantile = *quantileBinning
+	return AutoRange(source, dimentions, options)
+}
 
-				// trim back to just a new line, Don't want to keep putting id in the top of the file.
-				drilldowns[k] = "\n"
-			}
+/*
+needsFitting is true when the input has to be looked at before the grids can be built, either because
+it was asked for or a dimension uses quantile binning.
+*/
+func needsFitting(dimentions []Dimension) bool {
+	if *autoRange || *quantileBinning {
+		return true
+	}
+	for _, dimension := range dimentions {
+		if dimension.Scale == "quantile" {
+			return true
 		}
+	}
+	return false
+}
 
-		result, err = mpcReader.ReadEntry()
-		count = count + 1
+/*
+buildGrids reads everything in the input files and writes the grids, drill downs and dimension listing
+to outputDir.
+*/
+func buildGrids(paths []string, outputDir string, dimentions []Dimension, duplicatePolicy DuplicatePolicy) (*RunResult, error) {
+	var rejects *RejectsReport
+	var err error
+	if *tolerant {
+		rejects, err = NewRejectsReport(filepath.Join(outputDir, "rejects.txt"), *maxErrors)
+		if err != nil {
+			return nil, fmt.Errorf("error creating rejects report %v", err)
+		}
+		defer rejects.Close()
 	}
 
-	if err != nil && err != io.EOF {
-		log.Fatal(fmt.Sprintf("error reading line %d\n", count), err)
+	mpcReader, err := OpenInputs(*inputFormat, paths, duplicatePolicy, rejects)
+	if err != nil {
+		return nil, fmt.Errorf("error creating mpcReader %v", err)
 	}
+	defer mpcReader.Close()
 
-	for k, v := range drilldowns {
-		if v != "\n" {
-			os.MkdirAll(filepath.Dir(k), 0777)
-			f, err := openOrCreateFile(k)
-			if err != nil {
-				log.Fatal(err)
-			}
-			f.WriteString(v)
-			f.Close()
-		}
-		delete(drilldowns, k)
+	run, err := ProcessRecords(mpcReader, dimentions, outputDir)
+	if err != nil {
+		return nil, err
 	}
+	run.Duplicates = mpcReader.Dropped()
 
-	outputGrid(dimentions[:], resultTable)
-	RenderDimensions(*outputDir, dimentions[:])
+	outputGrid(outputDir, dimentions, run.Grids)
+	RenderDimensions(outputDir, withExclusions(dimentions, run.Excluded))
 
-	fmt.Printf("processed: %d flushes: %d\n", count, flushCount)
+	fmt.Printf("processed: %d flushes: %d duplicates dropped: %d\n", run.Records, run.Flushes, run.Duplicates)
+	if rejects != nil {
+		run.Rejected = rejects.Count()
+		fmt.Printf("rejected: %d\n", run.Rejected)
+	}
+	return run, nil
 }
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/wselwood/gompcreader"
+)
+
+/*
+DuplicatePolicy decides which record to keep when the same designation turns up more than once.
+*/
+type DuplicatePolicy int
+
+const (
+	// FirstWins keeps the first record seen for each designation.
+	FirstWins DuplicatePolicy = iota
+	// NewestEpochWins keeps the record with the most recent epoch of osculation.
+	NewestEpochWins
+	// MostObservationsWins keeps the record based on the most observations.
+	MostObservationsWins
+)
+
+/*
+ParseDuplicatePolicy converts a command line policy name into a DuplicatePolicy.
+*/
+func ParseDuplicatePolicy(name string) (DuplicatePolicy, error) {
+	switch name {
+	case "first":
+		return FirstWins, nil
+	case "newest":
+		return NewestEpochWins, nil
+	case "most-observations":
+		return MostObservationsWins, nil
+	}
+	return FirstWins, fmt.Errorf("unknown duplicate policy %q, expected first, newest or most-observations", name)
+}
+
+/*
+expandInputs splits a comma separated list of paths and expands any globs in it.
+Stdin is passed through untouched. Globs that match nothing are an error so typos are not silently ignored.
+*/
+func expandInputs(in string) ([]string, error) {
+	var result []string
+	for _, part := range strings.Split(in, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if part == StdinPath || !strings.ContainsAny(part, "*?[") {
+			result = append(result, part)
+			continue
+		}
+
+		matches, err := filepath.Glob(part)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", part)
+		}
+		result = append(result, matches...)
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no input files given")
+	}
+	return result, nil
+}
+
+/*
+sequenceReader reads each of the inputs in turn, opening the next one when the current runs out.
+*/
+type sequenceReader struct {
+	format  string
+	paths   []string
+	current RecordSource
+}
+
+func (reader *sequenceReader) Next() (*gompcreader.MinorPlanet, error) {
+	for {
+		if reader.current == nil {
+			if len(reader.paths) == 0 {
+				return nil, io.EOF
+			}
+			next, err := OpenSource(reader.format, reader.paths[0])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", reader.paths[0], err)
+			}
+			reader.current = next
+		}
+
+		result, err := reader.current.Next()
+		if err == io.EOF {
+			reader.current.Close()
+			reader.current = nil
+			reader.paths = reader.paths[1:]
+			continue
+		}
+		if _, ok := err.(*ParseError); ok {
+			// parse errors already say which file they came from and the reader can carry on after them.
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", reader.paths[0], err)
+		}
+		return result, nil
+	}
+}
+
+func (reader *sequenceReader) Close() error {
+	if reader.current != nil {
+		return reader.current.Close()
+	}
+	return nil
+}
+
+func (reader *sequenceReader) Source() SourceInfo {
+	if reader.current != nil {
+		return reader.current.Source()
+	}
+	return SourceInfo{Format: reader.format}
+}
+
+/*
+DedupReader drops records whose designation has already been seen. With FirstWins it streams,
+the other policies need to see every record before they can pick, so they read the input twice. The first
+pass only keeps the position and sort key of the best record for each designation, the second streams the
+records again and hands back the ones that won. The kept records come out where they were in the input.
+*/
+type DedupReader struct {
+	source   RecordSource
+	reopen   func() (RecordSource, error)
+	policy   DuplicatePolicy
+	seen     map[string]int
+	winners  map[string]winner
+	position int64
+	dropped  int64
+}
+
+/*
+winner is where the best record seen so far for a designation is in the input and the value it was picked on.
+*/
+type winner struct {
+	position int64
+	key      int64
+}
+
+/*
+newDedupReader creates a reader removing duplicates from source. reopen must give a fresh source over the same
+records for the policies that read the input twice, it is not used by FirstWins.
+*/
+func newDedupReader(source RecordSource, reopen func() (RecordSource, error), policy DuplicatePolicy) *DedupReader {
+	var result DedupReader
+	result.source = source
+	result.reopen = reopen
+	result.policy = policy
+	result.seen = make(map[string]int)
+	return &result
+}
+
+/*
+OpenInputs opens all the files in paths, as given by expandInputs or a snapshot, and merges them into a
+single stream with duplicates resolved by the policy. The paths are used as they are, they are not split
+or globbed again. If rejects is not nil records that fail to parse are written to it and skipped.
+*/
+func OpenInputs(format string, paths []string, policy DuplicatePolicy, rejects *RejectsReport) (*DedupReader, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no input files given")
+	}
+	if policy != FirstWins {
+		for _, path := range paths {
+			if path == StdinPath {
+				return nil, fmt.Errorf("-duplicates newest and most-observations read the input twice so can not be used with stdin")
+			}
+		}
+	}
+
+	// open the first file now so a bad path fails straight away rather than on the first read.
+	first, err := OpenSource(format, paths[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", paths[0], err)
+	}
+	var source RecordSource = &sequenceReader{format, paths, first}
+	if rejects != nil {
+		source = NewTolerantSource(source, rejects)
+	}
+
+	reopen := func() (RecordSource, error) {
+		var again RecordSource = &sequenceReader{format: format, paths: paths}
+		if rejects != nil {
+			// the bad records were reported on the first pass
+			again = NewTolerantSource(again, nil)
+		}
+		return again, nil
+	}
+	return newDedupReader(source, reopen, policy), nil
+}
+
+/*
+Next returns the next unique record, or io.EOF when there are no more.
+*/
+func (reader *DedupReader) Next() (*gompcreader.MinorPlanet, error) {
+	if reader.policy == FirstWins {
+		for {
+			result, err := reader.source.Next()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := reader.seen[result.ID]; ok {
+				reader.dropped = reader.dropped + 1
+				continue
+			}
+			reader.seen[result.ID] = 0
+			return result, nil
+		}
+	}
+
+	if reader.winners == nil {
+		if err := reader.pickWinners(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		result, err := reader.source.Next()
+		if err != nil {
+			return nil, err
+		}
+		reader.position = reader.position + 1
+		if reader.winners[result.ID].position == reader.position {
+			return result, nil
+		}
+	}
+}
+
+/*
+pickWinners reads every record noting where the best one for each designation is, then reopens the input
+ready to stream it again.
+*/
+func (reader *DedupReader) pickWinners() error {
+	reader.winners = make(map[string]winner)
+	var position int64
+	for {
+		entry, err := reader.source.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		position = position + 1
+
+		key := reader.key(entry)
+		current, ok := reader.winners[entry.ID]
+		if ok {
+			reader.dropped = reader.dropped + 1
+			if key <= current.key {
+				continue
+			}
+		}
+		reader.winners[entry.ID] = winner{position, key}
+	}
+	reader.source.Close()
+	again, err := reader.reopen()
+	if err != nil {
+		return err
+	}
+	reader.source = again
+	return nil
+}
+
+/*
+key is the value the policy compares, the record with the larger key wins.
+*/
+func (reader *DedupReader) key(entry *gompcreader.MinorPlanet) int64 {
+	switch reader.policy {
+	case NewestEpochWins:
+		return entry.Epoch.Unix()
+	case MostObservationsWins:
+		return entry.NumberOfObservations
+	}
+	return 0
+}
+
+/*
+Dropped returns the number of duplicate records that have been thrown away so far.
+*/
+func (reader *DedupReader) Dropped() int64 {
+	return reader.dropped
+}
+
+/*
+Close closes the underlying inputs.
+*/
+func (reader *DedupReader) Close() error {
+	return reader.source.Close()
+}
+
+/*
+Source describes the input currently being read.
+*/
+func (reader *DedupReader) Source() SourceInfo {
+	return reader.source.Source()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wselwood/gompcreader"
+)
+
+func planet(id string, year int, observations int64) *gompcreader.MinorPlanet {
+	var result gompcreader.MinorPlanet
+	result.ID = id
+	result.Epoch = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	result.NumberOfObservations = observations
+	return &result
+}
+
+func readAll(t *testing.T, reader RecordSource) []*gompcreader.MinorPlanet {
+	var result []*gompcreader.MinorPlanet
+	for {
+		entry, err := reader.Next()
+		if err == io.EOF {
+			return result
+		}
+		assert.NoError(t, err)
+		result = append(result, entry)
+	}
+}
+
+func duplicateEntries() []*gompcreader.MinorPlanet {
+	return []*gompcreader.MinorPlanet{
+		planet("a", 2010, 5),
+		planet("b", 2010, 5),
+		planet("a", 2015, 3),
+		planet("a", 2012, 9),
+	}
+}
+
+type duplicatePolicyTestCase struct {
+	policy       DuplicatePolicy
+	expectedYear int
+}
+
+var duplicatePolicyTestCases = []duplicatePolicyTestCase{
+	{FirstWins, 2010},
+	{NewestEpochWins, 2015},
+	{MostObservationsWins, 2012},
+}
+
+func TestDedupReader(t *testing.T) {
+	for _, tt := range duplicatePolicyTestCases {
+		reopen := func() (RecordSource, error) {
+			return NewSliceSource("duplicates", duplicateEntries()), nil
+		}
+		reader := newDedupReader(NewSliceSource("duplicates", duplicateEntries()), reopen, tt.policy)
+		result := readAll(t, reader)
+
+		assert.Len(t, result, 2)
+		for _, entry := range result {
+			if entry.ID == "a" {
+				assert.Equal(t, tt.expectedYear, entry.Epoch.Year(), "policy %d", tt.policy)
+			}
+		}
+		assert.Equal(t, int64(2), reader.Dropped())
+	}
+}
+
+func TestDedupReaderKeepsInputOrder(t *testing.T) {
+	reopen := func() (RecordSource, error) {
+		return NewSliceSource("duplicates", duplicateEntries()), nil
+	}
+	reader := newDedupReader(NewSliceSource("duplicates", duplicateEntries()), reopen, NewestEpochWins)
+	result := readAll(t, reader)
+
+	assert.Len(t, result, 2)
+	assert.Equal(t, "b", result[0].ID)
+	assert.Equal(t, "a", result[1].ID, "the winner comes out where it was in the input")
+}
+
+func TestParseDuplicatePolicy(t *testing.T) {
+	policy, err := ParseDuplicatePolicy("most-observations")
+	assert.NoError(t, err)
+	assert.Equal(t, MostObservationsWins, policy)
+
+	_, err = ParseDuplicatePolicy("last")
+	assert.Error(t, err)
+}
+
+func TestOpenInputsMergesFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astro-grid")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte(ceresLine+"\n"), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "b.txt"), []byte(singleOppositionLine+"\n"+ceresLine+"\n"), 0666)
+
+	paths, err := expandInputs(filepath.Join(dir, "*.txt"))
+	assert.NoError(t, err)
+	reader, err := OpenInputs("mpcorb", paths, FirstWins, nil)
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	result := readAll(t, reader)
+	assert.Len(t, result, 2)
+	assert.Equal(t, "00001", result[0].ID)
+	assert.Equal(t, "K19A01A", result[1].ID)
+	assert.Equal(t, int64(1), reader.Dropped())
+
+	reader, err = OpenInputs("mpcorb", paths, MostObservationsWins, nil)
+	assert.NoError(t, err)
+	defer reader.Close()
+	assert.Len(t, readAll(t, reader), 2)
+	assert.Equal(t, int64(1), reader.Dropped())
+
+	_, err = expandInputs(filepath.Join(dir, "*.dat"))
+	assert.Error(t, err, "glob with no matches")
+
+	_, err = OpenInputs("mpcorb", []string{StdinPath}, NewestEpochWins, nil)
+	assert.Error(t, err, "stdin can not be read twice")
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wselwood/gompcreader"
+)
+
+/*
+MpcorbReader reads MPCORB formatted records from any stream.
+
+gompcreader.NewMpcReader only takes the path of a gzipped file and its line parser is not exported, so
+there is no way to hand it stdin or a bzip2 or plain stream. This reader does the parsing itself into the
+same gompcreader.MinorPlanet so the rest of the program does not care which was used. It also skips the
+MPCORB.DAT header and reports the line of a bad record. -format gompcreader still reads through the
+library and the generate tests check the two agree.
+*/
+type MpcorbReader struct {
+	lineReader
+	started  bool
+	inHeader bool
+}
+
+/*
+NewMpcorbReader opens the path given (or stdin for "-") and returns a reader for the records in it.
+*/
+func NewMpcorbReader(path string) (*MpcorbReader, error) {
+	input, err := OpenInput(path)
+	if err != nil {
+		return nil, err
+	}
+	result := newMpcorbReader(input)
+	result.name = path
+	return result, nil
+}
+
+func newMpcorbReader(input io.ReadCloser) *MpcorbReader {
+	result := &MpcorbReader{lineReader: newLineReader(input, "mpcorb")}
+	result.skip = result.skipHeader
+	return result
+}
+
+/*
+skipHeader is true for the lines of the header block at the start of a full MPCORB.DAT file.
+*/
+func (reader *MpcorbReader) skipHeader(line string) bool {
+	if !reader.started {
+		reader.started = true
+		reader.inHeader = strings.HasPrefix(line, "MINOR PLANET CENTER")
+	}
+	if reader.inHeader {
+		if strings.HasPrefix(line, "-----") {
+			reader.inHeader = false
+		}
+		return true
+	}
+	return false
+}
+
+/*
+Next returns the next minor planet in the stream, or io.EOF when there are no more.
+The header block of a full MPCORB.DAT file and blank lines between sections are skipped.
+*/
+func (reader *MpcorbReader) Next() (*gompcreader.MinorPlanet, error) {
+	var result *gompcreader.MinorPlanet
+	err := reader.read(func(line string) (err error) {
+		result, err = parseMpcorbLine(line)
+		return err
+	})
+	return result, err
+}
+
+/*
+fieldReader pulls fixed width fields out of a line, remembering the first error it hits.
+Columns are 1 based and inclusive to match the published format descriptions.
+*/
+type fieldReader struct {
+	line string
+	err  error
+}
+
+func (reader *fieldReader) str(start int, end int) string {
+	if start > len(reader.line) {
+		return ""
+	}
+	if end > len(reader.line) {
+		end = len(reader.line)
+	}
+	return strings.TrimSpace(reader.line[start-1 : end])
+}
+
+func (reader *fieldReader) float(name string, start int, end int) float64 {
+	value := reader.str(start, end)
+	result, err := strconv.ParseFloat(value, 64)
+	if err != nil && reader.err == nil {
+		reader.err = fmt.Errorf("invalid %s %q", name, value)
+	}
+	return result
+}
+
+func (reader *fieldReader) optionalFloat(name string, start int, end int) float64 {
+	if reader.str(start, end) == "" {
+		return 0
+	}
+	return reader.float(name, start, end)
+}
+
+/*
+unknownFloat is for values where a blank means not known rather than zero, it gives NaN for them.
+*/
+func (reader *fieldReader) unknownFloat(name string, start int, end int) float64 {
+	if reader.str(start, end) == "" {
+		return math.NaN()
+	}
+	return reader.float(name, start, end)
+}
+
+func (reader *fieldReader) int(name string, start int, end int) int64 {
+	value := reader.str(start, end)
+	result, err := strconv.ParseInt(value, 10, 64)
+	if err != nil && reader.err == nil {
+		reader.err = fmt.Errorf("invalid %s %q", name, value)
+	}
+	return result
+}
+
+func (reader *fieldReader) optionalInt(name string, start int, end int) int64 {
+	if reader.str(start, end) == "" {
+		return 0
+	}
+	return reader.int(name, start, end)
+}
+
+func (reader *fieldReader) date(name string, start int, end int) time.Time {
+	value := reader.str(start, end)
+	result, err := time.Parse("20060102", value)
+	if err != nil && reader.err == nil {
+		reader.err = fmt.Errorf("invalid %s %q", name, value)
+	}
+	return result
+}
+
+func (reader *fieldReader) optionalDate(name string, start int, end int) time.Time {
+	if reader.str(start, end) == "" {
+		return time.Time{}
+	}
+	return reader.date(name, start, end)
+}
+
+/*
+parseMpcorbLine converts a single line of an MPCORB file into a minor planet.
+See http://minorplanetcenter.net/iau/info/MPOrbitFormat.html for the layout.
+*/
+func parseMpcorbLine(line string) (*gompcreader.MinorPlanet, error) {
+	if len(line) < 160 {
+		return nil, fmt.Errorf("line too short, %d characters", len(line))
+	}
+
+	var result gompcreader.MinorPlanet
+	fields := fieldReader{line: line}
+
+	result.ID = fields.str(1, 7)
+	if result.ID == "" {
+		return nil, fmt.Errorf("missing designation")
+	}
+	result.AbsoluteMagnitude = fields.unknownFloat("absolute magnitude", 9, 13)
+	result.Slope = fields.optionalFloat("slope", 15, 19)
+	epoch, err := unpackEpoch(fields.str(21, 25))
+	if err != nil {
+		return nil, err
+	}
+	result.Epoch = epoch
+	result.MeanAnomalyEpoch = fields.float("mean anomaly", 27, 35)
+	result.ArgumentOfPerihelion = fields.float("argument of perihelion", 38, 46)
+	result.LongitudeOfTheAscendingNode = fields.float("longitude of the ascending node", 49, 57)
+	result.InclinationToTheEcliptic = fields.float("inclination", 60, 68)
+	result.OrbitalEccentricity = fields.float("eccentricity", 71, 79)
+	result.MeanDailyMotion = fields.float("mean daily motion", 81, 91)
+	result.SemimajorAxis = fields.float("semimajor axis", 93, 103)
+	result.UncertaintyParameter = fields.str(106, 106)
+	result.Reference = fields.str(108, 116)
+	result.NumberOfObservations = fields.optionalInt("number of observations", 118, 122)
+	result.NumberOfOppositions = fields.optionalInt("number of oppositions", 124, 126)
+
+	if strings.HasSuffix(fields.str(128, 136), "days") {
+		result.ArcLength = fields.int("arc length", 128, 131)
+	} else {
+		result.YearOfFirstObservation = fields.int("year of first observation", 128, 131)
+		result.YearOfLastObservation = fields.int("year of last observation", 133, 136)
+	}
+
+	result.RmsResidual = fields.optionalFloat("rms residual", 138, 141)
+	result.ShortPerturbersIdentifier = fields.str(143, 145)
+	result.LongPerturbersIdentifier = fields.str(147, 149)
+	result.ComputerName = fields.str(151, 160)
+	result.HexFlags = fields.str(162, 165)
+	result.ReadableDesignation = fields.str(167, 194)
+
+	result.LastObservation = fields.optionalDate("date of last observation", 195, 202)
+
+	if fields.err != nil {
+		return nil, fields.err
+	}
+	return &result, nil
+}
+
+/*
+unpackEpoch converts the MPC packed date form, e.g. K194R, into a time.
+*/
+func unpackEpoch(packed string) (time.Time, error) {
+	if len(packed) != 5 {
+		return time.Time{}, fmt.Errorf("invalid epoch %q", packed)
+	}
+
+	century := strings.IndexByte("IJK", packed[0])
+	year, err := strconv.Atoi(packed[1:3])
+	month := unpackDigit(packed[3])
+	day := unpackDigit(packed[4])
+	if century < 0 || err != nil || month < 1 || month > 12 || day < 1 || day > 31 {
+		return time.Time{}, fmt.Errorf("invalid epoch %q", packed)
+	}
+
+	return time.Date(1800+century*100+year, time.Month(month), day, 0, 0, 0, 0, time.UTC), nil
+}
+
+/*
+unpackDigit decodes the base 32 style digits used in packed dates. 1-9 then A=10 through V=31
+*/
+func unpackDigit(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'V':
+		return int(c-'A') + 10
+	}
+	return -1
+}
+
+/*
+packEpoch converts a time into the MPC packed date form, the reverse of unpackEpoch.
+*/
+func packEpoch(epoch time.Time) (string, error) {
+	century := epoch.Year()/100 - 18
+	if century < 0 || century > 2 {
+		return "", fmt.Errorf("epoch %v out of range", epoch)
+	}
+	return fmt.Sprintf("%c%02d%c%c", "IJK"[century], epoch.Year()%100, packDigit(int(epoch.Month())), packDigit(epoch.Day())), nil
+}
+
+func packDigit(value int) byte {
+	if value < 10 {
+		return byte('0' + value)
+	}
+	return byte('A' + value - 10)
+}
+
+/*
+packNumber converts a minor planet number into the five character packed form used in column 1.
+Numbers over 99999 use a letter for the leading digits, A=10 through z=61.
+*/
+func packNumber(number int) (string, error) {
+	const letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	if number < 1 || number >= (len(letters)+10)*10000 {
+		return "", fmt.Errorf("number %d can not be packed", number)
+	}
+	if number < 100000 {
+		return fmt.Sprintf("%05d", number), nil
+	}
+	return fmt.Sprintf("%c%04d", letters[number/10000-10], number%10000), nil
+}
+
+/*
+packDesignation converts a number or provisional designation, e.g. 433 or 2004 MN4, into the packed form
+used for the MPCORB IDs, 00433 or K04M04N. Survey designations such as 2040 P-L are packed as PLS2040.
+Anything else, like a comet designation, is returned unchanged.
+*/
+func packDesignation(designation string) string {
+	const cycleLetters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	if number, err := strconv.Atoi(designation); err == nil {
+		if packed, err := packNumber(number); err == nil {
+			return packed
+		}
+		return designation
+	}
+
+	parts := strings.Fields(designation)
+	if len(parts) != 2 {
+		return designation
+	}
+
+	surveys := map[string]string{"P-L": "PLS", "T-1": "T1S", "T-2": "T2S", "T-3": "T3S"}
+	if survey, ok := surveys[parts[1]]; ok && len(parts[0]) == 4 {
+		return survey + parts[0]
+	}
+
+	year, err := strconv.Atoi(parts[0])
+	letters := parts[1]
+	if err != nil || len(parts[0]) != 4 || year < 1800 || year > 2099 || len(letters) < 2 ||
+		letters[0] < 'A' || letters[0] > 'Z' || letters[1] < 'A' || letters[1] > 'Z' {
+		return designation
+	}
+	cycle := 0
+	if len(letters) > 2 {
+		cycle, err = strconv.Atoi(letters[2:])
+		if err != nil || cycle < 0 || cycle >= len(cycleLetters)*10 {
+			return designation
+		}
+	}
+	return fmt.Sprintf("%c%02d%c%c%d%c", "IJK"[year/100-18], year%100, letters[0], cycleLetters[cycle/10], cycle%10, letters[1])
+}
+
+/*
+readableDesignationColumn lays out a readable designation the way MPCORB does. Numbers are right aligned
+with the closing bracket in column 174 so the names line up, other designations start in column 172.
+*/
+func readableDesignationColumn(designation string) string {
+	if strings.HasPrefix(designation, "(") {
+		if end := strings.IndexByte(designation, ')'); end >= 0 && end < 8 {
+			return strings.Repeat(" ", 7-end) + designation
+		}
+		return designation
+	}
+	return "     " + designation
+}
+
+/*
+formatMpcorbLine writes a minor planet out as an MPCORB line, the reverse of parseMpcorbLine.
+Objects with an ArcLength and no observation years are written as single opposition orbits.
+*/
+func formatMpcorbLine(in *gompcreader.MinorPlanet) (string, error) {
+	epoch, err := packEpoch(in.Epoch)
+	if err != nil {
+		return "", err
+	}
+	if in.SemimajorAxis >= 10000 || in.OrbitalEccentricity >= 10 {
+		return "", fmt.Errorf("orbit of %s does not fit the MPCORB columns", in.ID)
+	}
+
+	arc := fmt.Sprintf("%04d-%04d", in.YearOfFirstObservation, in.YearOfLastObservation)
+	if in.YearOfFirstObservation == 0 && in.ArcLength > 0 {
+		arc = fmt.Sprintf("%4d days", in.ArcLength)
+	}
+
+	magnitude := fmt.Sprintf("%5.2f", in.AbsoluteMagnitude)
+	if math.IsNaN(in.AbsoluteMagnitude) {
+		magnitude = ""
+	}
+
+	lastObs := ""
+	if !in.LastObservation.IsZero() {
+		lastObs = in.LastObservation.Format("20060102")
+	}
+
+	return fmt.Sprintf("%-7.7s %5s %5.2f %5s %9.5f  %9.5f  %9.5f  %9.5f  %9.7f %11.8f %11.7f  %1.1s %-9.9s %5d %3d %9s %4.2f %-3.3s %-3.3s %-10.10s %4.4s %-28.28s%s",
+		in.ID, magnitude, in.Slope, epoch,
+		in.MeanAnomalyEpoch, in.ArgumentOfPerihelion, in.LongitudeOfTheAscendingNode, in.InclinationToTheEcliptic,
+		in.OrbitalEccentricity, in.MeanDailyMotion, in.SemimajorAxis,
+		in.UncertaintyParameter, in.Reference, in.NumberOfObservations, in.NumberOfOppositions, arc,
+		in.RmsResidual, in.ShortPerturbersIdentifier, in.LongPerturbersIdentifier, in.ComputerName,
+		in.HexFlags, readableDesignationColumn(in.ReadableDesignation), lastObs), nil
+}
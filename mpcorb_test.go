@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const ceresLine = "00001    3.34  0.12 K205V 162.68631   73.73161   80.28698   10.58862  0.0775571  0.21406009   2.7676569  0 MPO492748  6751 115 1801-2019 0.60 M-v 30h Williams   0000      (1) Ceres              20190915"
+const singleOppositionLine = "K19A01A 18.2   0.12 K205V 162.68631   73.73161   80.28698   10.58862  0.0775571  0.21406009   2.7676569  E MPO492748    21   1   12 days 0.60 M-v 30h Williams   0800      2019 AA1               20190915"
+
+func TestParseMpcorbLine(t *testing.T) {
+	result, err := parseMpcorbLine(ceresLine)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "00001", result.ID)
+	assert.Equal(t, 3.34, result.AbsoluteMagnitude)
+	assert.Equal(t, time.Date(2020, time.May, 31, 0, 0, 0, 0, time.UTC), result.Epoch)
+	assert.Equal(t, 10.58862, result.InclinationToTheEcliptic)
+	assert.Equal(t, 0.0775571, result.OrbitalEccentricity)
+	assert.Equal(t, 2.7676569, result.SemimajorAxis)
+	assert.Equal(t, "0", result.UncertaintyParameter)
+	assert.Equal(t, int64(6751), result.NumberOfObservations)
+	assert.Equal(t, int64(115), result.NumberOfOppositions)
+	assert.Equal(t, int64(1801), result.YearOfFirstObservation)
+	assert.Equal(t, int64(2019), result.YearOfLastObservation)
+	assert.Equal(t, "(1) Ceres", result.ReadableDesignation)
+	assert.Equal(t, time.Date(2019, time.September, 15, 0, 0, 0, 0, time.UTC), result.LastObservation)
+}
+
+func TestParseMpcorbLineSingleOpposition(t *testing.T) {
+	result, err := parseMpcorbLine(singleOppositionLine)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "E", result.UncertaintyParameter)
+	assert.Equal(t, int64(12), result.ArcLength)
+	assert.Equal(t, int64(0), result.YearOfFirstObservation)
+	assert.Equal(t, "0800", result.HexFlags)
+}
+
+func TestParseMpcorbLineErrors(t *testing.T) {
+	_, err := parseMpcorbLine("00001    3.34  0.12 K205V")
+	assert.Error(t, err, "short line")
+
+	_, err = parseMpcorbLine(strings.Replace(ceresLine, "0.0775571", "0.07x5571", 1))
+	assert.Error(t, err, "bad eccentricity")
+
+	_, err = parseMpcorbLine(strings.Replace(ceresLine, "K205V", "X205V", 1))
+	assert.Error(t, err, "bad epoch")
+}
+
+type epochTestCase struct {
+	in  string
+	out time.Time
+}
+
+var epochTestCases = []epochTestCase{
+	{"K205V", time.Date(2020, time.May, 31, 0, 0, 0, 0, time.UTC)},
+	{"J9611", time.Date(1996, time.January, 1, 0, 0, 0, 0, time.UTC)},
+	{"I98CA", time.Date(1898, time.December, 10, 0, 0, 0, 0, time.UTC)},
+}
+
+func TestUnpackEpoch(t *testing.T) {
+	for _, tt := range epochTestCases {
+		result, err := unpackEpoch(tt.in)
+		assert.NoError(t, err, tt.in)
+		assert.Equal(t, tt.out, result, tt.in)
+	}
+}
+
+var designationTestCases = []struct {
+	in  string
+	out string
+}{
+	{"1", "00001"},
+	{"123456", "C3456"},
+	{"2004 MN4", "K04M04N"},
+	{"2019 AA", "K19A00A"},
+	{"1998 SQ108", "J98SA8Q"},
+	{"2040 P-L", "PLS2040"},
+	{"3138 T-1", "T1S3138"},
+	{"1P", "1P"},
+	{"C/2020 F3", "C/2020 F3"},
+}
+
+func TestPackDesignation(t *testing.T) {
+	for _, tt := range designationTestCases {
+		assert.Equal(t, tt.out, packDesignation(tt.in), tt.in)
+	}
+}
+
+func TestMpcorbReaderSkipsHeader(t *testing.T) {
+	input := "MINOR PLANET CENTER ORBIT DATABASE (MPCORB)\nsome header text\n-----------\n" +
+		ceresLine + "\n\n" + singleOppositionLine + "\n"
+	reader := newMpcorbReader(ioutil.NopCloser(strings.NewReader(input)))
+
+	first, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "00001", first.ID)
+
+	second, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "K19A01A", second.ID)
+
+	_, err = reader.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+var bzip2PlainText = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xfc, 0x50, 0x0d, 0x2b, 0x00, 0x00,
+	0x03, 0xd1, 0x80, 0x00, 0x10, 0x40, 0x00, 0x22, 0x25, 0x44, 0x40, 0x20, 0x00, 0x31, 0x00, 0x30,
+	0x20, 0x06, 0xd4, 0x09, 0x4e, 0x06, 0xf1, 0xde, 0x2e, 0xe4, 0x8a, 0x70, 0xa1, 0x21, 0xf8, 0xa0,
+	0x1a, 0x56,
+}
+
+func gzipMembers(members ...string) []byte {
+	var buf bytes.Buffer
+	for _, member := range members {
+		w := gzip.NewWriter(&buf)
+		w.Write([]byte(member))
+		w.Close()
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressDetection(t *testing.T) {
+	inputs := map[string][]byte{
+		"plain":  []byte("plain text\n"),
+		"gzip":   gzipMembers("plain text\n"),
+		"concat": gzipMembers("plain ", "text\n"),
+		"bzip2":  bzip2PlainText,
+	}
+
+	for name, in := range inputs {
+		stream, err := decompress(ioutil.NopCloser(bytes.NewReader(in)))
+		assert.NoError(t, err, name)
+		out, err := ioutil.ReadAll(stream)
+		assert.NoError(t, err, name)
+		assert.Equal(t, "plain text\n", string(out), name)
+	}
+}
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+Observation is a single optical observation from an MPC 80 column observation file.
+ObjectObservations is the total number of observations of the same object in the input, it is filled in
+by the first pass over the files so the per object dimension can be binned on the second.
+*/
+type Observation struct {
+	ID                 string
+	Date               time.Time
+	Magnitude          float64
+	Band               string
+	Observatory        string
+	ObjectObservations int64
+}
+
+/*
+ObservationReader reads MPC 80 column observation records from any stream.
+See http://www.minorplanetcenter.net/iau/info/OpticalObs.html for the layout.
+The second lines of satellite and roving observer records, radar observations and deleted observations,
+marked X or x in column 15, are skipped.
+*/
+type ObservationReader struct {
+	lineReader
+}
+
+/*
+NewObservationReader opens the path given (or stdin for "-") and returns a reader for the observations in it.
+*/
+func NewObservationReader(path string) (*ObservationReader, error) {
+	input, err := OpenInput(path)
+	if err != nil {
+		return nil, err
+	}
+	result := newObservationReader(input)
+	result.name = path
+	return result, nil
+}
+
+func newObservationReader(input io.ReadCloser) *ObservationReader {
+	result := ObservationReader{newLineReader(input, "obs80")}
+	result.skip = skipObservationLine
+	return &result
+}
+
+/*
+skipObservationLine is true for the lines that are not optical observations, see ObservationReader.
+*/
+func skipObservationLine(line string) bool {
+	return len(line) >= 15 && strings.ContainsRune("srvRXx", rune(line[14]))
+}
+
+/*
+Next returns the next observation, or io.EOF when there are no more.
+*/
+func (reader *ObservationReader) Next() (*Observation, error) {
+	var result *Observation
+	err := reader.read(func(line string) (err error) {
+		result, err = parseObservationLine(line)
+		return err
+	})
+	return result, err
+}
+
+func parseObservationLine(line string) (*Observation, error) {
+	if len(line) < 80 {
+		return nil, fmt.Errorf("line too short, %d characters", len(line))
+	}
+
+	var result Observation
+	fields := fieldReader{line: line}
+
+	result.ID = fields.str(1, 5)
+	if result.ID == "" {
+		result.ID = fields.str(6, 12)
+	}
+	if result.ID == "" {
+		return nil, fmt.Errorf("missing designation")
+	}
+
+	year := fields.int("year", 16, 19)
+	month := fields.int("month", 21, 22)
+	day := fields.float("day", 24, 32)
+	if fields.err == nil && (month < 1 || month > 12 || day < 1 || day >= 32) {
+		return nil, fmt.Errorf("invalid date %q", fields.str(16, 32))
+	}
+	whole, fraction := math.Modf(day)
+	result.Date = time.Date(int(year), time.Month(month), int(whole), 0, 0, 0, 0, time.UTC).
+		Add(time.Duration(fraction * float64(24*time.Hour)))
+
+	result.Magnitude = fields.optionalFloat("magnitude", 66, 70)
+	result.Band = fields.str(71, 71)
+	result.Observatory = fields.str(78, 80)
+	if result.Observatory == "" {
+		return nil, fmt.Errorf("missing observatory code")
+	}
+
+	if fields.err != nil {
+		return nil, fields.err
+	}
+	return &result, nil
+}
+
+/*
+ObservationExtractor is for extracting the cell an observation should live in.
+*/
+type ObservationExtractor interface {
+	ExtractCell(*Observation) int32
+	Extract(*Observation) string
+}
+
+/*
+ObservationDimension is an axis for the observation grids. It uses the same fields as Dimension
+so the output is the same shape and the viewer can show it. ObservationValue is the value being binned,
+in the units of MinValue and MaxValue, it is used to tell underflow from overflow.
+*/
+type ObservationDimension struct {
+	Dimension
+	ObservationExtractor ObservationExtractor       `json:"-"`
+	ObservationValue     func(*Observation) float64 `json:"-"`
+}
+
+/*
+CategoryExtractor puts each observation in the cell for its category, everything not listed goes
+in the last cell.
+*/
+type CategoryExtractor struct {
+	cells map[string]int32
+	other int32
+	value func(*Observation) string
+}
+
+func newCategoryExtractor(categories []string, value func(*Observation) string) *CategoryExtractor {
+	var result CategoryExtractor
+	result.cells = make(map[string]int32)
+	for i, category := range categories {
+		result.cells[category] = int32(i)
+	}
+	result.other = int32(len(categories))
+	result.value = value
+	return &result
+}
+
+/*
+ExtractCell for the category
+*/
+func (extractor *CategoryExtractor) ExtractCell(in *Observation) int32 {
+	if cell, ok := extractor.cells[extractor.value(in)]; ok {
+		return cell
+	}
+	return extractor.other
+}
+
+/*
+Extract the category, or other if it is not one of the listed ones.
+*/
+func (extractor *CategoryExtractor) Extract(in *Observation) string {
+	value := extractor.value(in)
+	if _, ok := extractor.cells[value]; ok {
+		return value
+	}
+	return "other"
+}
+
+/*
+ObservationYearExtractor bins observations by year.
+*/
+type ObservationYearExtractor struct {
+	minValue int
+	maxValue int
+}
+
+/*
+ExtractCell for the year of observation
+*/
+func (extractor *ObservationYearExtractor) ExtractCell(in *Observation) int32 {
+	year := in.Date.Year()
+	if year < extractor.minValue || year > extractor.maxValue {
+		return -1
+	}
+	return int32(year - extractor.minValue)
+}
+
+/*
+Extract the year of observation
+*/
+func (extractor *ObservationYearExtractor) Extract(in *Observation) string {
+	return fmt.Sprintf("%d", in.Date.Year())
+}
+
+/*
+ObservationMonthExtractor bins observations by the month of the year to show seasonal patterns.
+*/
+type ObservationMonthExtractor struct {
+}
+
+/*
+ExtractCell for the month of observation
+*/
+func (extractor *ObservationMonthExtractor) ExtractCell(in *Observation) int32 {
+	return int32(in.Date.Month()) - 1
+}
+
+/*
+Extract the month of observation
+*/
+func (extractor *ObservationMonthExtractor) Extract(in *Observation) string {
+	return in.Date.Month().String()
+}
+
+/*
+ObservationsPerObjectExtractor bins the number of observations of the observed object in powers of two.
+Cell n holds objects with between 2^n and 2^(n+1)-1 observations.
+*/
+type ObservationsPerObjectExtractor struct {
+	gridSize int32
+}
+
+/*
+ExtractCell for the observations per object
+*/
+func (extractor *ObservationsPerObjectExtractor) ExtractCell(in *Observation) int32 {
+	if in.ObjectObservations < 1 {
+		return -1
+	}
+	cell := int32(math.Log2(float64(in.ObjectObservations)))
+	if cell >= extractor.gridSize {
+		return -1
+	}
+	return cell
+}
+
+/*
+Extract the lower bound of the observations per object bin
+*/
+func (extractor *ObservationsPerObjectExtractor) Extract(in *Observation) string {
+	cell := extractor.ExtractCell(in)
+	if cell < 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%d", int64(1)<<uint(cell))
+}
+
+var observationBands = []string{"", "U", "B", "V", "R", "I", "J", "H", "K", "G", "u", "g", "r", "i", "z", "y", "w", "o", "c", "L"}
+
+const maxObservatoryCells = 100
+
+/*
+BuildObservationDimensions creates the dimensions for observation grids. The observatory dimension uses
+the busiest observatories from the counts given with the rest grouped together as other.
+*/
+func BuildObservationDimensions(observatoryCounts map[string]int64) []ObservationDimension {
+	return []ObservationDimension{
+		buildObservatoryCode(observatoryCounts),
+		buildObservationYear(),
+		buildObservationMonth(),
+		buildObservationBand(),
+		buildObservationsPerObject(),
+	}
+}
+
+func buildObservatoryCode(observatoryCounts map[string]int64) ObservationDimension {
+	var codes []string
+	for code := range observatoryCounts {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if observatoryCounts[codes[i]] != observatoryCounts[codes[j]] {
+			return observatoryCounts[codes[i]] > observatoryCounts[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+	if len(codes) > maxObservatoryCells-1 {
+		codes = codes[:maxObservatoryCells-1]
+	}
+
+	var result ObservationDimension
+	result.Dimension = categoricalDimension("Observatory-Code", append(codes, "other"), "MPC observatory code, busiest first")
+	result.ObservationExtractor = newCategoryExtractor(codes, func(in *Observation) string { return in.Observatory })
+	return result
+}
+
+func buildObservationYear() ObservationDimension {
+	var result ObservationDimension
+
+	result.Name = "Observation-Year"
+	result.MinValue = 1900
+	result.MaxValue = 2030
+	result.GridSize = 131
+	result.StepSize = 1.0
+	result.Description = "Year the observation was made"
+	result.ObservationExtractor = &ObservationYearExtractor{1900, 2030}
+	result.ObservationValue = func(in *Observation) float64 { return float64(in.Date.Year()) }
+
+	return result
+}
+
+func buildObservationMonth() ObservationDimension {
+	var result ObservationDimension
+
+	result.Name = "Observation-Month"
+	result.MinValue = 1
+	result.MaxValue = 13
+	result.GridSize = 12
+	result.StepSize = 1.0
+	result.Description = "Month of the year the observation was made"
+	result.ObservationExtractor = &ObservationMonthExtractor{}
+
+	return result
+}
+
+func buildObservationBand() ObservationDimension {
+	labels := make([]string, len(observationBands))
+	for i, band := range observationBands {
+		labels[i] = band
+		if band == "" {
+			labels[i] = "none"
+		}
+	}
+
+	var result ObservationDimension
+	result.Dimension = categoricalDimension("Observation-Band", append(labels, "other"), "Magnitude band, none when no band was reported")
+	result.ObservationExtractor = newCategoryExtractor(labels, func(in *Observation) string {
+		if in.Band == "" {
+			return "none"
+		}
+		return in.Band
+	})
+	return result
+}
+
+func buildObservationsPerObject() ObservationDimension {
+	var result ObservationDimension
+
+	result.Name = "Observations-Per-Object"
+	result.MinValue = 0
+	result.MaxValue = 20
+	result.GridSize = 20
+	result.StepSize = 1.0
+	result.Description = "Number of observations of the object in the file, cell n is 2^n to 2^(n+1)-1 observations"
+	result.ObservationExtractor = &ObservationsPerObjectExtractor{20}
+	result.ObservationValue = func(in *Observation) float64 {
+		if in.ObjectObservations < 1 {
+			return math.NaN()
+		}
+		return math.Log2(float64(in.ObjectObservations))
+	}
+
+	return result
+}
+
+/*
+readObservations calls fn with each observation in the files in turn. With tolerant set observations that
+fail to parse are skipped, and written to rejects if it is not nil, otherwise they stop the read.
+*/
+func readObservations(paths []string, tolerant bool, rejects *RejectsReport, fn func(*Observation)) error {
+	for _, path := range paths {
+		reader, err := NewObservationReader(path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		err = readObservationFile(reader, tolerant, rejects, fn)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readObservationFile(reader *ObservationReader, tolerant bool, rejects *RejectsReport, fn func(*Observation)) error {
+	for {
+		observation, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if rejected, ok := err.(*ParseError); ok && tolerant {
+			if rejects != nil {
+				if err := rejects.Add(rejected); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if _, ok := err.(*ParseError); ok {
+			return err
+		} else if err != nil {
+			return fmt.Errorf("%s: %v", reader.name, err)
+		}
+		fn(observation)
+	}
+}
+
+/*
+ProcessObservations builds grids over the observation dimensions for 80 column observation files.
+The files are read twice, first to count observations per object and observatory and then to fill the grids,
+so they can not be read from stdin. If rejects is not nil observations that fail to parse are written to it
+and skipped. Observation grids do not have drill down lists.
+*/
+func ProcessObservations(paths []string, outputDir string, rejects *RejectsReport) (*RunResult, []ObservationDimension, error) {
+	for _, path := range paths {
+		if path == StdinPath {
+			return nil, nil, fmt.Errorf("observation files are read twice so can not come from stdin")
+		}
+	}
+
+	perObject := make(map[string]int64)
+	perObservatory := make(map[string]int64)
+	err := readObservations(paths, rejects != nil, rejects, func(observation *Observation) {
+		perObject[observation.ID] = perObject[observation.ID] + 1
+		perObservatory[observation.Observatory] = perObservatory[observation.Observatory] + 1
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	dimensions := BuildObservationDimensions(perObservatory)
+	plain := make([]Dimension, len(dimensions))
+	for i := range dimensions {
+		plain[i] = dimensions[i].Dimension
+	}
+
+	var run RunResult
+	run.Grids = BuildResultsGrid(plain)
+	run.Excluded = make([]Exclusions, len(dimensions))
+	cells := make([]int32, len(dimensions))
+
+	// the bad observations were reported on the first pass
+	err = readObservations(paths, rejects != nil, nil, func(observation *Observation) {
+		observation.ObjectObservations = perObject[observation.ID]
+
+		for i := 0; i < len(dimensions); i++ {
+			cells[i] = dimensions[i].ObservationExtractor.ExtractCell(observation)
+			if cells[i] < 0 || int(cells[i]) >= dimensions[i].GridSize {
+				value := math.NaN()
+				if dimensions[i].ObservationValue != nil {
+					value = dimensions[i].ObservationValue(observation)
+				}
+				cells[i] = excludedCell(plain[i], value, cells[i])
+				run.Excluded[i].add(plain[i], cells[i])
+			}
+		}
+
+		for i := 0; i < len(dimensions); i++ {
+			x := cells[i]
+			for j := 0; j < len(dimensions); j++ {
+				y := cells[j]
+				cell := &run.Grids[i][j].G[x][y]
+				if cell.Count == 0 {
+					cell.X = int(x)
+					cell.Y = int(y)
+					cell.StartX = observationCellLabel(dimensions[i], observation, x)
+					cell.StartY = observationCellLabel(dimensions[j], observation, y)
+				}
+				cell.Count = cell.Count + 1
+			}
+		}
+
+		run.Records = run.Records + 1
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range run.Excluded {
+		run.Excluded[i].Records = run.Records
+	}
+
+	os.MkdirAll(outputDir, 0777)
+	outputGrid(outputDir, plain, run.Grids)
+	RenderDimensions(outputDir, withExclusions(plain, run.Excluded))
+
+	return &run, dimensions, nil
+}
+
+/*
+observationCellLabel is the label for a cell, the excluded cells are labelled with what they hold.
+*/
+func observationCellLabel(dimension ObservationDimension, observation *Observation, cell int32) string {
+	if int(cell) >= dimension.GridSize {
+		return excludedLabels[int(cell)-dimension.GridSize]
+	}
+	return dimension.ObservationExtractor.Extract(observation)
+}
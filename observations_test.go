@@ -0,0 +1,169 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const ceresObservationLine = "00001         C2019 09 15.50000 12 34 56.78 +12 34 56.7           16.5V      568"
+const provisionalObservationLine = "     K19A01A  C2019 01 02.25000 01 02 03.45 -05 06 07.8                      F51"
+const satelliteSecondLine = "     K19A01A  s2019 01 02.25000 1 + 1234.5678   - 2345.6789   + 3456.7890    C51"
+
+func TestParseObservationLine(t *testing.T) {
+	result, err := parseObservationLine(ceresObservationLine)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "00001", result.ID)
+	assert.Equal(t, time.Date(2019, time.September, 15, 12, 0, 0, 0, time.UTC), result.Date)
+	assert.Equal(t, 16.5, result.Magnitude)
+	assert.Equal(t, "V", result.Band)
+	assert.Equal(t, "568", result.Observatory)
+
+	result, err = parseObservationLine(provisionalObservationLine)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "K19A01A", result.ID)
+	assert.Equal(t, time.Date(2019, time.January, 2, 6, 0, 0, 0, time.UTC), result.Date)
+	assert.Equal(t, "", result.Band)
+	assert.Equal(t, "F51", result.Observatory)
+}
+
+func TestParseObservationLineErrors(t *testing.T) {
+	_, err := parseObservationLine("00001         C2019 09 15.50000")
+	assert.Error(t, err, "short line")
+
+	_, err = parseObservationLine(strings.Replace(ceresObservationLine, "2019 09", "2019 13", 1))
+	assert.Error(t, err, "bad month")
+
+	_, err = parseObservationLine(strings.Replace(ceresObservationLine, "00001", "     ", 1))
+	assert.Error(t, err, "no designation")
+}
+
+func TestObservationReaderSkipsSecondLines(t *testing.T) {
+	input := strings.Join([]string{ceresObservationLine, "", provisionalObservationLine, satelliteSecondLine}, "\n")
+	reader := newObservationReader(ioutil.NopCloser(strings.NewReader(input)))
+
+	var ids []string
+	result, err := reader.Next()
+	for err == nil {
+		ids = append(ids, result.ID)
+		result, err = reader.Next()
+	}
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, []string{"00001", "K19A01A"}, ids)
+}
+
+func TestObservationReaderSkipsDeleted(t *testing.T) {
+	deleted := ceresObservationLine[:14] + "x" + ceresObservationLine[15:]
+	input := strings.Join([]string{deleted, provisionalObservationLine}, "\n")
+	reader := newObservationReader(ioutil.NopCloser(strings.NewReader(input)))
+
+	result, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "K19A01A", result.ID)
+	_, err = reader.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestProcessObservationsFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astro-grid")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	first := filepath.Join(dir, "first.obs")
+	second := filepath.Join(dir, "second.obs")
+	ioutil.WriteFile(first, []byte(ceresObservationLine+"\ngarbage\n"), 0666)
+	ioutil.WriteFile(second, []byte(provisionalObservationLine+"\n"+ceresObservationLine+"\n"), 0666)
+
+	_, _, err = ProcessObservations([]string{first, second}, filepath.Join(dir, "strict"), nil)
+	_, ok := err.(*ParseError)
+	assert.True(t, ok, "bad lines stop the run without a rejects report")
+
+	report, err := NewRejectsReport(filepath.Join(dir, "rejects.txt"), 0)
+	assert.NoError(t, err)
+	defer report.Close()
+
+	run, _, err := ProcessObservations([]string{first, second}, filepath.Join(dir, "out"), report)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), run.Records)
+	assert.Equal(t, int64(1), report.Count(), "bad lines are only reported once")
+
+	_, _, err = ProcessObservations([]string{StdinPath}, filepath.Join(dir, "stdin"), nil)
+	assert.Error(t, err)
+}
+
+type observationCellTestCase struct {
+	in  *Observation
+	out int32
+}
+
+func TestObservationExtractors(t *testing.T) {
+	dimensions := BuildObservationDimensions(map[string]int64{"568": 10, "F51": 20, "C51": 20})
+
+	cases := []struct {
+		dimension int
+		cases     []observationCellTestCase
+	}{
+		{0, []observationCellTestCase{
+			{&Observation{Observatory: "C51"}, 0},
+			{&Observation{Observatory: "F51"}, 1},
+			{&Observation{Observatory: "568"}, 2},
+			{&Observation{Observatory: "X05"}, 3},
+		}},
+		{1, []observationCellTestCase{
+			{&Observation{Date: time.Date(1899, time.May, 1, 0, 0, 0, 0, time.UTC)}, -1},
+			{&Observation{Date: time.Date(1900, time.May, 1, 0, 0, 0, 0, time.UTC)}, 0},
+			{&Observation{Date: time.Date(2019, time.May, 1, 0, 0, 0, 0, time.UTC)}, 119},
+		}},
+		{2, []observationCellTestCase{
+			{&Observation{Date: time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)}, 0},
+			{&Observation{Date: time.Date(2019, time.December, 1, 0, 0, 0, 0, time.UTC)}, 11},
+		}},
+		{3, []observationCellTestCase{
+			{&Observation{Band: ""}, 0},
+			{&Observation{Band: "V"}, 3},
+			{&Observation{Band: "Q"}, int32(len(observationBands))},
+		}},
+		{4, []observationCellTestCase{
+			{&Observation{ObjectObservations: 0}, -1},
+			{&Observation{ObjectObservations: 1}, 0},
+			{&Observation{ObjectObservations: 3}, 1},
+			{&Observation{ObjectObservations: 1024}, 10},
+		}},
+	}
+
+	for _, dimension := range cases {
+		for _, c := range dimension.cases {
+			assert.Equal(t, c.out, dimensions[dimension.dimension].ObservationExtractor.ExtractCell(c.in), dimensions[dimension.dimension].Name)
+		}
+	}
+}
+
+func TestObservationExcludedCells(t *testing.T) {
+	dimensions := BuildObservationDimensions(map[string]int64{"568": 10})
+
+	cases := []struct {
+		dimension int
+		in        *Observation
+		out       int
+	}{
+		{1, &Observation{Date: time.Date(1850, time.May, 1, 0, 0, 0, 0, time.UTC)}, underflowCell},
+		{1, &Observation{Date: time.Date(2040, time.May, 1, 0, 0, 0, 0, time.UTC)}, overflowCell},
+		{4, &Observation{ObjectObservations: 0}, missingCell},
+		{4, &Observation{ObjectObservations: 1 << 21}, overflowCell},
+	}
+
+	for _, c := range cases {
+		dimension := dimensions[c.dimension]
+		cell := dimension.ObservationExtractor.ExtractCell(c.in)
+		value := dimension.ObservationValue(c.in)
+		assert.Equal(t, int32(dimension.GridSize+c.out), excludedCell(dimension.Dimension, value, cell), dimension.Name)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wselwood/gompcreader"
+)
+
+/*
+RunResult holds the grids built from a record source and some counts about the run.
+*/
+type RunResult struct {
+	Grids      [][]Grid
+	Records    int64
+	Flushes    int64
+	Duplicates int64
+	Rejected   int64
+	Excluded   []Exclusions
+}
+
+/*
+Exclusions counts the records that are not in any cell of a dimension. Underflow and Overflow are below
+and above the range, Missing is everything else, such as records without the value or with a label the
+dimension does not know. The cells of a dimension plus these add up to Records.
+*/
+type Exclusions struct {
+	Records   int64 `json:"records"`
+	Underflow int64 `json:"underflow"`
+	Overflow  int64 `json:"overflow"`
+	Missing   int64 `json:"missing"`
+}
+
+/*
+The grids have three more cells after the end of each dimension for the records that are not in it, so
+they can be seen against the other dimensions. These are the offsets of those cells from the grid size.
+*/
+const (
+	underflowCell = iota
+	overflowCell
+	missingCell
+	excludedCells
+)
+
+var excludedLabels = []string{"underflow", "overflow", "missing"}
+
+/*
+excludedCell picks the underflow, overflow or missing cell for a record that is not in the grid for the
+dimension. cell is what the extractor gave for it and value is the record's value for the dimension, NaN
+when it does not have one.
+*/
+func excludedCell(dimension Dimension, value float64, cell int32) int32 {
+	if int(cell) >= dimension.GridSize {
+		return int32(dimension.GridSize + overflowCell)
+	}
+	switch {
+	case math.IsNaN(value):
+		return int32(dimension.GridSize + missingCell)
+	case value < dimension.MinValue:
+		return int32(dimension.GridSize + underflowCell)
+	case value >= dimension.MaxValue:
+		return int32(dimension.GridSize + overflowCell)
+	default:
+		return int32(dimension.GridSize + missingCell)
+	}
+}
+
+/*
+add counts a record in one of the excluded cells of the dimension.
+*/
+func (exclusions *Exclusions) add(dimension Dimension, cell int32) {
+	switch int(cell) - dimension.GridSize {
+	case underflowCell:
+		exclusions.Underflow = exclusions.Underflow + 1
+	case overflowCell:
+		exclusions.Overflow = exclusions.Overflow + 1
+	default:
+		exclusions.Missing = exclusions.Missing + 1
+	}
+}
+
+/*
+ProcessRecords reads every record from the source, counting it into the grid for each pair of dimensions
+and writing the drill down lists under outputDir as it goes.
+*/
+func ProcessRecords(source RecordSource, dimentions []Dimension, outputDir string) (*RunResult, error) {
+	var run RunResult
+	run.Grids = BuildResultsGrid(dimentions)
+
+	run.Excluded = make([]Exclusions, len(dimentions))
+
+	drilldowns := make(map[string]string)
+	cells := make([][]int32, len(dimentions))
+
+	result, err := source.Next()
+	for err == nil {
+
+		for i := 0; i < len(dimentions); i++ {
+			cells[i] = inGrid(dimentions[i], extractCells(dimentions[i], result, cells[i][:0]))
+			if len(cells[i]) == 0 {
+				cell := int32(-1)
+				if !dimentions[i].MultiValued {
+					cell = dimentions[i].Extractor.ExtractCell(result)
+				}
+				value := math.NaN()
+				if dimentions[i].Value != nil {
+					value = dimentions[i].Value(result)
+				}
+				cell = excludedCell(dimentions[i], value, cell)
+				run.Excluded[i].add(dimentions[i], cell)
+				cells[i] = append(cells[i], cell)
+			}
+		}
+
+		for i := 0; i < len(dimentions); i++ {
+			for _, x := range cells[i] {
+				for j := 0; j < len(dimentions); j++ {
+					for _, y := range cells[j] {
+						grid := run.Grids[i][j].G
+						if *debugMode {
+							fmt.Printf("i:%2d, j:%2d, x:%3d, y:%3d, c:%d\n", i, j, x, y, run.Records)
+						}
+						if grid[x][y].Count == 0 {
+							grid[x][y].X = int(x)
+							grid[x][y].Y = int(y)
+							grid[x][y].StartX = cellLabel(dimentions[i], result, x)
+							grid[x][y].StartY = cellLabel(dimentions[j], result, y)
+						}
+						grid[x][y].Count = grid[x][y].Count + 1
+						drillDownPath := fmt.Sprintf("%s/%s/%s/%d/%d.txt", outputDir, dimentions[i].Name, dimentions[j].Name, x, y)
+						v, k := drilldowns[drillDownPath]
+						if !k {
+							v = "id\n"
+						}
+						drilldowns[drillDownPath] = v + result.ID + "\n"
+					}
+				}
+			}
+		}
+
+		// flush what we have so far to keep our memory useage to a reasonable level.
+		if run.Records%10000 == 0 {
+			run.Flushes = run.Flushes + 1
+			for k, v := range drilldowns {
+				// only try and create the folders if we know it is new.
+				if strings.HasPrefix(v, "id\n") {
+					os.MkdirAll(filepath.Dir(k), 0777)
+				}
+
+				f, err := openOrCreateFile(k)
+				if err != nil {
+					log.Fatal(err)
+				}
+				f.WriteString(strings.TrimRight(v, "\n"))
+				f.Close()
+
+				// trim back to just a new line, Don't want to keep putting id in the top of the file.
+				drilldowns[k] = "\n"
+			}
+		}
+
+		result, err = source.Next()
+		run.Records = run.Records + 1
+	}
+
+	if _, ok := err.(*ParseError); ok {
+		return nil, err
+	} else if err != io.EOF {
+		return nil, fmt.Errorf("error reading %s: %v", source.Source(), err)
+	}
+
+	for k, v := range drilldowns {
+		if v != "\n" {
+			os.MkdirAll(filepath.Dir(k), 0777)
+			f, err := openOrCreateFile(k)
+			if err != nil {
+				log.Fatal(err)
+			}
+			f.WriteString(v)
+			f.Close()
+		}
+		delete(drilldowns, k)
+	}
+
+	for i := range run.Excluded {
+		run.Excluded[i].Records = run.Records
+	}
+	return &run, nil
+}
+
+/*
+withExclusions copies the dimensions with the exclusion counts from a run, ready to be rendered. The
+excluded cells are added to the buckets so the viewer can label them.
+*/
+func withExclusions(dimensions []Dimension, excluded []Exclusions) []Dimension {
+	result := make([]Dimension, len(dimensions))
+	copy(result, dimensions)
+	for i := range result {
+		result[i].Excluded = &excluded[i]
+		buckets := make([]Bucket, len(result[i].Buckets), len(result[i].Buckets)+excludedCells)
+		copy(buckets, result[i].Buckets)
+		for offset, label := range excludedLabels {
+			buckets = append(buckets, Bucket{result[i].GridSize + offset, label})
+		}
+		result[i].Buckets = buckets
+	}
+	return result
+}
+
+/*
+inGrid drops the cells that are outside the dimension's grid, keeping the order of the rest.
+*/
+func inGrid(dimension Dimension, cells []int32) []int32 {
+	result := cells[:0]
+	for _, cell := range cells {
+		if cell >= 0 && int(cell) < dimension.GridSize {
+			result = append(result, cell)
+		}
+	}
+	return result
+}
+
+/*
+extractCells appends the cells the record is in for the dimension to buffer. This is one cell unless the
+dimension's extractor is a MultiValueExtractor.
+*/
+func extractCells(dimension Dimension, in *gompcreader.MinorPlanet, buffer []int32) []int32 {
+	if multi, ok := dimension.Extractor.(MultiValueExtractor); ok {
+		return multi.ExtractCells(in, buffer)
+	}
+	return append(buffer, dimension.Extractor.ExtractCell(in))
+}
+
+/*
+cellLabel is the label for a cell. Multi valued dimensions take it from the buckets as the extractor only
+knows the label of the first cell. The excluded cells are labelled with what they hold.
+*/
+func cellLabel(dimension Dimension, in *gompcreader.MinorPlanet, cell int32) string {
+	if int(cell) >= dimension.GridSize {
+		return excludedLabels[int(cell)-dimension.GridSize]
+	}
+	if dimension.MultiValued {
+		for _, bucket := range dimension.Buckets {
+			if bucket.Cell == int(cell) {
+				return bucket.Label
+			}
+		}
+	}
+	return dimension.Extractor.Extract(in)
+}
+
+func openOrCreateFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0666)
+}
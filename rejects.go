@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/wselwood/gompcreader"
+)
+
+/*
+ParseError is returned by the readers when a single record could not be understood.
+The reader can carry on to the next record after one of these.
+*/
+type ParseError struct {
+	Source SourceInfo
+	Raw    string
+	Reason string
+}
+
+func (err *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s", err.Source, err.Reason)
+}
+
+/*
+RejectsReport writes the records that could not be parsed to a tab separated file so they can be looked at later.
+Once more than maxErrors records have been rejected it gives up, as the input is probably corrupt. A maxErrors of
+zero means there is no limit.
+*/
+type RejectsReport struct {
+	file      *os.File
+	out       *bufio.Writer
+	maxErrors int64
+	count     int64
+}
+
+/*
+NewRejectsReport creates the report file at path.
+*/
+func NewRejectsReport(path string, maxErrors int64) (*RejectsReport, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var result RejectsReport
+	result.file = f
+	result.out = bufio.NewWriter(f)
+	result.maxErrors = maxErrors
+	result.out.WriteString("source\tline\treason\traw\n")
+	return &result, nil
+}
+
+/*
+Add records a rejected line. It returns an error once the number of rejects goes over the limit.
+*/
+func (report *RejectsReport) Add(rejected *ParseError) error {
+	report.count = report.count + 1
+	fmt.Fprintf(report.out, "%s\t%d\t%s\t%s\n", rejected.Source.Name, rejected.Source.Line, rejected.Reason, rejected.Raw)
+
+	if report.maxErrors > 0 && report.count > report.maxErrors {
+		return fmt.Errorf("too many bad records, giving up after %d. Last one was %v", report.count, rejected)
+	}
+	return nil
+}
+
+/*
+Count returns the number of records rejected so far.
+*/
+func (report *RejectsReport) Count() int64 {
+	return report.count
+}
+
+/*
+Close flushes and closes the report file.
+*/
+func (report *RejectsReport) Close() error {
+	if err := report.out.Flush(); err != nil {
+		report.file.Close()
+		return err
+	}
+	return report.file.Close()
+}
+
+/*
+TolerantSource skips over records that fail to parse, logging them to the rejects report.
+*/
+type TolerantSource struct {
+	source RecordSource
+	report *RejectsReport
+}
+
+/*
+NewTolerantSource wraps source so bad records are reported rather than stopping the run.
+A nil report skips them without recording anything, for reading an input that has already been reported on.
+*/
+func NewTolerantSource(source RecordSource, report *RejectsReport) *TolerantSource {
+	return &TolerantSource{source, report}
+}
+
+/*
+Next returns the next record that parses.
+*/
+func (source *TolerantSource) Next() (*gompcreader.MinorPlanet, error) {
+	for {
+		result, err := source.source.Next()
+		rejected, ok := err.(*ParseError)
+		if !ok {
+			return result, err
+		}
+		if source.report == nil {
+			continue
+		}
+		if err := source.report.Add(rejected); err != nil {
+			return nil, err
+		}
+	}
+}
+
+/*
+Close closes the underlying source.
+*/
+func (source *TolerantSource) Close() error {
+	return source.source.Close()
+}
+
+/*
+Source describes the underlying source.
+*/
+func (source *TolerantSource) Source() SourceInfo {
+	return source.source.Source()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func badMpcorbInput() string {
+	return ceresLine + "\n" +
+		strings.Replace(ceresLine, "0.0775571", "0.07x5571", 1) + "\n" +
+		"garbage\n" +
+		singleOppositionLine + "\n"
+}
+
+func TestTolerantSourceSkipsBadLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astro-grid")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	report, err := NewRejectsReport(filepath.Join(dir, "rejects.txt"), 0)
+	assert.NoError(t, err)
+
+	reader := newMpcorbReader(ioutil.NopCloser(strings.NewReader(badMpcorbInput())))
+	reader.name = "MPCORB.DAT"
+	result := readAll(t, NewTolerantSource(reader, report))
+	assert.NoError(t, report.Close())
+
+	assert.Len(t, result, 2)
+	assert.Equal(t, "K19A01A", result[1].ID)
+	assert.Equal(t, int64(2), report.Count())
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "rejects.txt"))
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, "MPCORB.DAT\t2\tinvalid eccentricity \"0.07x5571\"\t"+strings.Replace(ceresLine, "0.0775571", "0.07x5571", 1), lines[1])
+	assert.Equal(t, "MPCORB.DAT\t3\tline too short, 7 characters\tgarbage", lines[2])
+}
+
+func TestTolerantSourceMaxErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astro-grid")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	report, err := NewRejectsReport(filepath.Join(dir, "rejects.txt"), 1)
+	assert.NoError(t, err)
+	defer report.Close()
+
+	reader := newMpcorbReader(ioutil.NopCloser(strings.NewReader(badMpcorbInput())))
+	source := NewTolerantSource(reader, report)
+
+	_, err = source.Next()
+	assert.NoError(t, err)
+	_, err = source.Next()
+	assert.Error(t, err, "second bad line goes over the limit")
+}
+
+func TestStrictReaderStops(t *testing.T) {
+	reader := newMpcorbReader(ioutil.NopCloser(strings.NewReader(badMpcorbInput())))
+	reader.Next()
+
+	_, err := reader.Next()
+	rejected, ok := err.(*ParseError)
+	assert.True(t, ok, "bad lines give a ParseError")
+	assert.Equal(t, int64(2), rejected.Source.Line)
+}
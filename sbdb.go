@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wselwood/gompcreader"
+)
+
+/*
+SbdbReader reads CSV exports from the JPL Small-Body Database query tool.
+Columns are located by their header names so the export can contain extra columns in any order.
+*/
+type SbdbReader struct {
+	input   io.ReadCloser
+	name    string
+	csv     *csv.Reader
+	columns map[string]int
+	line    int64
+}
+
+var sbdbRequiredColumns = []string{"e", "i"}
+
+/*
+NewSbdbReader opens the path given (or stdin for "-") and reads the header row.
+*/
+func NewSbdbReader(path string) (*SbdbReader, error) {
+	input, err := OpenInput(path)
+	if err != nil {
+		return nil, err
+	}
+	result, err := newSbdbReader(input)
+	if err != nil {
+		input.Close()
+		return nil, err
+	}
+	result.name = path
+	return result, nil
+}
+
+func newSbdbReader(input io.ReadCloser) (*SbdbReader, error) {
+	var result SbdbReader
+	result.input = input
+	result.csv = csv.NewReader(input)
+	result.csv.FieldsPerRecord = -1
+
+	header, err := result.csv.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read sbdb header: %v", err)
+	}
+	result.line = 1
+
+	result.columns = make(map[string]int)
+	for i, name := range header {
+		result.columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range sbdbRequiredColumns {
+		if _, ok := result.columns[name]; !ok {
+			return nil, fmt.Errorf("sbdb file is missing the %s column", name)
+		}
+	}
+	_, hasA := result.columns["a"]
+	_, hasQ := result.columns["q"]
+	if !hasA && !hasQ {
+		return nil, fmt.Errorf("sbdb file needs either an a or q column")
+	}
+
+	return &result, nil
+}
+
+/*
+Next returns the next row as a minor planet, or io.EOF when there are no more.
+*/
+func (reader *SbdbReader) Next() (*gompcreader.MinorPlanet, error) {
+	row, err := reader.csv.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+	reader.line = reader.line + 1
+	if malformed, ok := err.(*csv.ParseError); ok {
+		// the csv reader carries on from the next row after one of these, so it can be skipped like any other bad record
+		return nil, &ParseError{reader.Source(), strings.Join(row, ","), malformed.Err.Error()}
+	} else if err != nil {
+		return nil, err
+	}
+
+	result, err := reader.convert(row)
+	if err != nil {
+		return nil, &ParseError{reader.Source(), strings.Join(row, ","), err.Error()}
+	}
+	return result, nil
+}
+
+/*
+Close closes the underlying stream.
+*/
+func (reader *SbdbReader) Close() error {
+	return reader.input.Close()
+}
+
+/*
+Source describes the file being read and the line of the last record.
+*/
+func (reader *SbdbReader) Source() SourceInfo {
+	return SourceInfo{reader.name, "sbdb", reader.line}
+}
+
+func (reader *SbdbReader) convert(row []string) (*gompcreader.MinorPlanet, error) {
+	var result gompcreader.MinorPlanet
+	fields := csvFields{row: row, columns: reader.columns}
+
+	// pack the designation so the same object from MPCORB is seen as a duplicate when merging
+	result.ID = packDesignation(fields.str("pdes"))
+	if result.ID == "" {
+		result.ID = fields.str("full_name")
+	}
+	if result.ID == "" {
+		result.ID = fields.str("spkid")
+	}
+	if result.ID == "" {
+		return nil, fmt.Errorf("missing designation")
+	}
+
+	result.OrbitalEccentricity = fields.float("e")
+	result.InclinationToTheEcliptic = fields.float("i")
+	result.SemimajorAxis = fields.float("a")
+	// the same as the comet reader, a parabolic orbit keeps q in place of the semi-major axis
+	if result.OrbitalEccentricity == 1 {
+		result.SemimajorAxis = fields.float("q")
+	} else if fields.str("a") == "" {
+		result.SemimajorAxis = fields.float("q") / (1 - result.OrbitalEccentricity)
+	}
+	result.AbsoluteMagnitude = fields.unknownFloat("H")
+	result.Slope = fields.float("G")
+	result.LongitudeOfTheAscendingNode = fields.float("om")
+	result.ArgumentOfPerihelion = fields.float("w")
+	result.MeanAnomalyEpoch = fields.float("ma")
+	result.MeanDailyMotion = fields.float("n")
+	result.RmsResidual = fields.float("rms")
+	result.NumberOfObservations = fields.int("n_obs_used")
+	result.UncertaintyParameter = fields.str("condition_code")
+	result.ReadableDesignation = fields.str("full_name")
+	result.YearOfFirstObservation = fields.year("first_obs")
+	result.YearOfLastObservation = fields.year("last_obs")
+	result.LastObservation = fields.date("last_obs")
+	result.ArcLength = fields.int("data_arc")
+	// the record has no first observation date, the arc from the real dates lets it be worked back exactly
+	if first := fields.date("first_obs"); !first.IsZero() && !result.LastObservation.IsZero() {
+		result.ArcLength = int64(result.LastObservation.Sub(first).Hours() / 24)
+	}
+	if epoch := fields.float("epoch"); epoch != 0 {
+		result.Epoch = julianDateToTime(epoch)
+	}
+
+	if fields.err != nil {
+		return nil, fields.err
+	}
+	return &result, nil
+}
+
+/*
+csvFields looks up named values in a csv row, remembering the first error it hits.
+Missing columns and empty values are both treated as zero.
+*/
+type csvFields struct {
+	row     []string
+	columns map[string]int
+	err     error
+}
+
+func (fields *csvFields) str(name string) string {
+	i, ok := fields.columns[name]
+	if !ok || i >= len(fields.row) {
+		return ""
+	}
+	return strings.TrimSpace(fields.row[i])
+}
+
+func (fields *csvFields) float(name string) float64 {
+	value := fields.str(name)
+	if value == "" {
+		return 0
+	}
+	result, err := strconv.ParseFloat(value, 64)
+	if err != nil && fields.err == nil {
+		fields.err = fmt.Errorf("invalid %s %q", name, value)
+	}
+	return result
+}
+
+/*
+unknownFloat is for values where an empty value means not known rather than zero, it gives NaN for them.
+*/
+func (fields *csvFields) unknownFloat(name string) float64 {
+	if fields.str(name) == "" {
+		return math.NaN()
+	}
+	return fields.float(name)
+}
+
+func (fields *csvFields) int(name string) int64 {
+	value := fields.str(name)
+	if value == "" {
+		return 0
+	}
+	result, err := strconv.ParseInt(value, 10, 64)
+	if err != nil && fields.err == nil {
+		fields.err = fmt.Errorf("invalid %s %q", name, value)
+	}
+	return result
+}
+
+/*
+date reads a YYYY-MM-DD date. Exports that only give the year leave it unset.
+*/
+func (fields *csvFields) date(name string) time.Time {
+	value := fields.str(name)
+	if len(value) < 10 {
+		return time.Time{}
+	}
+	result, err := time.Parse("2006-01-02", value[:10])
+	if err != nil && fields.err == nil {
+		fields.err = fmt.Errorf("invalid %s %q", name, value)
+	}
+	return result
+}
+
+/*
+year pulls the year from the front of a YYYY-MM-DD date
+*/
+func (fields *csvFields) year(name string) int64 {
+	value := fields.str(name)
+	if value == "" {
+		return 0
+	}
+	if len(value) < 4 {
+		if fields.err == nil {
+			fields.err = fmt.Errorf("invalid %s %q", name, value)
+		}
+		return 0
+	}
+	result, err := strconv.ParseInt(value[:4], 10, 64)
+	if err != nil && fields.err == nil {
+		fields.err = fmt.Errorf("invalid %s %q", name, value)
+	}
+	return result
+}
+
+/*
+julianDateToTime converts a julian date into a time.
+*/
+func julianDateToTime(jd float64) time.Time {
+	const unixEpochJD = 2440587.5
+	seconds := (jd - unixEpochJD) * 86400
+	return time.Unix(int64(seconds), 0).UTC()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sbdbExport = `pdes,full_name,a,e,i,q,H,first_obs,last_obs
+1,"     1 Ceres (A801 AA)",2.767,.0785,10.59,2.55,3.34,1801-01-01,2019-09-15
+2019 AA1,"       (2019 AA1)",,.5,4.2,1.2,18.2,2019-01-01,2019-01-13
+`
+
+func TestSbdbReader(t *testing.T) {
+	reader, err := newSbdbReader(ioutil.NopCloser(strings.NewReader(sbdbExport)))
+	assert.NoError(t, err)
+
+	ceres, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "00001", ceres.ID)
+	assert.Equal(t, 2.767, ceres.SemimajorAxis)
+	assert.Equal(t, 0.0785, ceres.OrbitalEccentricity)
+	assert.Equal(t, 10.59, ceres.InclinationToTheEcliptic)
+	assert.Equal(t, 3.34, ceres.AbsoluteMagnitude)
+	assert.Equal(t, int64(1801), ceres.YearOfFirstObservation)
+	assert.Equal(t, int64(2019), ceres.YearOfLastObservation)
+	assert.Equal(t, "2019-09-15", ceres.LastObservation.Format("2006-01-02"))
+	assert.Equal(t, 1801.0+0.5/31/12, firstObservation(ceres), "first observation read from first_obs")
+
+	derived, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "K19A01A", derived.ID)
+	assert.Equal(t, 2.4, derived.SemimajorAxis, "semi-major axis derived from q")
+	assert.Equal(t, int64(12), derived.ArcLength)
+
+	_, err = reader.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestSbdbReaderErrors(t *testing.T) {
+	_, err := newSbdbReader(ioutil.NopCloser(strings.NewReader("pdes,a,H\n1,2.7,3.3\n")))
+	assert.Error(t, err, "missing columns")
+
+	reader, err := newSbdbReader(ioutil.NopCloser(strings.NewReader("pdes,a,e,i\n1,2.7,x,10\n")))
+	assert.NoError(t, err)
+	_, err = reader.Next()
+	assert.Error(t, err, "bad eccentricity")
+}
+
+func TestSbdbReaderMalformedRow(t *testing.T) {
+	input := "pdes,a,e,i\n1,2.7,0.1,10\n2,2\"7,0.1,10\n3,2.7,0.1,10\n"
+	reader, err := newSbdbReader(ioutil.NopCloser(strings.NewReader(input)))
+	assert.NoError(t, err)
+
+	_, err = reader.Next()
+	assert.NoError(t, err)
+
+	_, err = reader.Next()
+	rejected, ok := err.(*ParseError)
+	assert.True(t, ok, "malformed csv gives a ParseError")
+	assert.Equal(t, int64(3), rejected.Source.Line)
+
+	third, err := reader.Next()
+	assert.NoError(t, err, "reading carries on after a malformed row")
+	assert.Equal(t, "00003", third.ID)
+}
+
+func TestSbdbReaderUnboundOrbits(t *testing.T) {
+	input := "pdes,full_name,a,e,i,q\nC/2019 Q4,\"C/2019 Q4 (Borisov)\",-.85144696,3.356633,44.05,2.006548\n" +
+		"C/2020 X1,\"C/2020 X1\",,1,10,1.5\n"
+	reader, err := newSbdbReader(ioutil.NopCloser(strings.NewReader(input)))
+	assert.NoError(t, err)
+
+	hyperbolic, err := reader.Next()
+	assert.NoError(t, err)
+	comet, err := parseCometLine(borisovLine)
+	assert.NoError(t, err)
+	assert.InDelta(t, perihelionDistance(comet), perihelionDistance(hyperbolic), 0.0001, "bins the same as the comet file")
+
+	parabolic, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, perihelionDistance(parabolic))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+/*
+Snapshot is one dated copy of the catalogue. Several files with the same date, e.g. MPCORB.DAT and NEA.txt
+from the same month, are merged into one snapshot.
+*/
+type Snapshot struct {
+	Date       string   `json:"date"`
+	Files      []string `json:"files"`
+	Records    int64    `json:"records"`
+	Duplicates int64    `json:"duplicates"`
+	Rejected   int64    `json:"rejected,omitempty"`
+}
+
+var snapshotDatePattern = regexp.MustCompile(`((?:19|20)\d{2})[-_]?(0[1-9]|1[0-2])(?:[-_]?(0[1-9]|[12]\d|3[01]))?`)
+
+/*
+snapshotDate pulls a date out of a file name, e.g. MPCORB-2015-07.DAT.gz gives 2015-07 and
+mpcorb_20150714.dat gives 2015-07-14.
+*/
+func snapshotDate(name string) (string, bool) {
+	match := snapshotDatePattern.FindStringSubmatch(filepath.Base(name))
+	if match == nil {
+		return "", false
+	}
+	if match[3] == "" {
+		return fmt.Sprintf("%s-%s", match[1], match[2]), true
+	}
+	return fmt.Sprintf("%s-%s-%s", match[1], match[2], match[3]), true
+}
+
+/*
+FindSnapshots lists the dated files in dir grouped by date, oldest first.
+Files without a date in their name are skipped.
+*/
+func FindSnapshots(dir string) ([]Snapshot, []string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byDate := make(map[string]*Snapshot)
+	var skipped []string
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		date, ok := snapshotDate(file.Name())
+		if !ok {
+			skipped = append(skipped, file.Name())
+			continue
+		}
+		snapshot, ok := byDate[date]
+		if !ok {
+			snapshot = &Snapshot{Date: date}
+			byDate[date] = snapshot
+		}
+		snapshot.Files = append(snapshot.Files, filepath.Join(dir, file.Name()))
+	}
+
+	var result []Snapshot
+	for _, snapshot := range byDate {
+		result = append(result, *snapshot)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Date < result[j].Date })
+
+	if len(result) == 0 {
+		return nil, skipped, fmt.Errorf("no dated files found in %s", dir)
+	}
+	return result, skipped, nil
+}
+
+/*
+RenderSnapshotIndex writes the list of snapshots to the outputDir given
+*/
+func RenderSnapshotIndex(outputDir string, snapshots []Snapshot) {
+	out := fmt.Sprintf("%s/snapshots.json", outputDir)
+	f, err := os.Create(out)
+	if err != nil {
+		log.Fatal("Error opening snapshot index", err)
+	}
+	defer f.Close()
+
+	js, e := json.Marshal(snapshots)
+	if e == nil {
+		f.WriteString(fmt.Sprintf("%s\n", js))
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type snapshotDateTestCase struct {
+	in  string
+	out string
+	ok  bool
+}
+
+var snapshotDateTestCases = []snapshotDateTestCase{
+	{"MPCORB-2015-07.DAT.gz", "2015-07", true},
+	{"mpcorb_20150714.dat", "2015-07-14", true},
+	{"/archive/2015/NEA_2015-07-14.txt", "2015-07-14", true},
+	{"201513.dat", "", false},
+	{"MPCORB.DAT", "", false},
+}
+
+func TestSnapshotDate(t *testing.T) {
+	for _, tt := range snapshotDateTestCases {
+		date, ok := snapshotDate(tt.in)
+		assert.Equal(t, tt.ok, ok, tt.in)
+		assert.Equal(t, tt.out, date, tt.in)
+	}
+}
+
+func TestFindSnapshots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astro-grid")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"MPCORB-2016-01.DAT", "MPCORB-2015-07.DAT", "NEA-2016-01.txt", "notes.txt"} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte{}, 0666)
+	}
+
+	snapshots, skipped, err := FindSnapshots(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"notes.txt"}, skipped)
+	assert.Len(t, snapshots, 2)
+	assert.Equal(t, "2015-07", snapshots[0].Date)
+	assert.Equal(t, "2016-01", snapshots[1].Date)
+	assert.Equal(t, []string{filepath.Join(dir, "MPCORB-2016-01.DAT"), filepath.Join(dir, "NEA-2016-01.txt")}, snapshots[1].Files)
+}
+
+func TestSnapshotFilesAreNotGlobbed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astro-grid")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "MPCORB,[a]*-2015-07.DAT"), []byte(ceresLine+"\n"), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "a-2015-07.DAT"), []byte(singleOppositionLine+"\n"), 0666)
+
+	snapshots, _, err := FindSnapshots(dir)
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 1)
+
+	reader, err := OpenInputs("mpcorb", snapshots[0].Files, FirstWins, nil)
+	assert.NoError(t, err)
+	defer reader.Close()
+	result := readAll(t, reader)
+	assert.Len(t, result, 2, "each file is read once under its own name")
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/wselwood/gompcreader"
+)
+
+/*
+RecordSource is anything that can hand back minor planets one at a time.
+Next returns io.EOF once there are no more records.
+*/
+type RecordSource interface {
+	Next() (*gompcreader.MinorPlanet, error)
+	Close() error
+	Source() SourceInfo
+}
+
+/*
+SourceInfo describes where the records are currently coming from.
+Line is the line of the last record read, or the record count for sources that are not line based.
+*/
+type SourceInfo struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	Line   int64  `json:"line,omitempty"`
+}
+
+/*
+String formats the source for error messages.
+*/
+func (info SourceInfo) String() string {
+	if info.Line > 0 {
+		return fmt.Sprintf("%s (%s) line %d", info.Name, info.Format, info.Line)
+	}
+	return fmt.Sprintf("%s (%s)", info.Name, info.Format)
+}
+
+/*
+OpenSource builds the record source for the given input format.
+*/
+func OpenSource(format string, path string) (RecordSource, error) {
+	var source RecordSource
+	var err error
+	switch format {
+	case "mpcorb":
+		source, err = NewMpcorbReader(path)
+	case "sbdb":
+		source, err = NewSbdbReader(path)
+	case "astorb":
+		source, err = NewAstorbReader(path)
+	case "comet":
+		source, err = NewCometReader(path)
+	case "gompcreader":
+		source, err = NewGompcreaderSource(path)
+	default:
+		return nil, fmt.Errorf("unknown input format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+/*
+GompcreaderSource reads MPCORB files using the gompcreader library's own reader.
+It only supports gzipped files on disk.
+*/
+type GompcreaderSource struct {
+	reader *gompcreader.MpcReader
+	name   string
+	count  int64
+}
+
+/*
+NewGompcreaderSource opens a gzipped MPCORB file with gompcreader.
+*/
+func NewGompcreaderSource(path string) (*GompcreaderSource, error) {
+	reader, err := gompcreader.NewMpcReader(path)
+	if err != nil {
+		return nil, err
+	}
+	return &GompcreaderSource{reader: reader, name: path}, nil
+}
+
+/*
+Next returns the next minor planet from gompcreader.
+*/
+func (source *GompcreaderSource) Next() (*gompcreader.MinorPlanet, error) {
+	result, err := source.reader.ReadEntry()
+	if err == nil {
+		source.count = source.count + 1
+	}
+	return result, err
+}
+
+/*
+Close closes the gompcreader reader.
+*/
+func (source *GompcreaderSource) Close() error {
+	source.reader.Close()
+	return nil
+}
+
+/*
+Source describes the file being read. gompcreader does not expose line numbers so this is the record count.
+*/
+func (source *GompcreaderSource) Source() SourceInfo {
+	return SourceInfo{source.name, "gompcreader", source.count}
+}
+
+/*
+SliceSource hands back records from memory. Useful for tests and synthetic data.
+*/
+type SliceSource struct {
+	records  []*gompcreader.MinorPlanet
+	name     string
+	position int
+}
+
+/*
+NewSliceSource creates a source over the records given.
+*/
+func NewSliceSource(name string, records []*gompcreader.MinorPlanet) *SliceSource {
+	return &SliceSource{records: records, name: name}
+}
+
+/*
+Next returns the next record in the slice.
+*/
+func (source *SliceSource) Next() (*gompcreader.MinorPlanet, error) {
+	if source.position >= len(source.records) {
+		return nil, io.EOF
+	}
+	result := source.records[source.position]
+	source.position = source.position + 1
+	return result, nil
+}
+
+/*
+Close does nothing for a slice.
+*/
+func (source *SliceSource) Close() error {
+	return nil
+}
+
+/*
+Source describes the slice.
+*/
+func (source *SliceSource) Source() SourceInfo {
+	return SourceInfo{source.name, "memory", int64(source.position)}
+}
+
+/*
+ChannelSource hands back records sent on a channel until it is closed.
+This lets records be produced by another goroutine.
+*/
+type ChannelSource struct {
+	records <-chan *gompcreader.MinorPlanet
+	name    string
+	count   int64
+	closed  bool
+}
+
+/*
+NewChannelSource creates a source reading from the channel given.
+*/
+func NewChannelSource(name string, records <-chan *gompcreader.MinorPlanet) *ChannelSource {
+	return &ChannelSource{records: records, name: name}
+}
+
+/*
+Next blocks until a record is available, returning io.EOF once the channel is closed.
+*/
+func (source *ChannelSource) Next() (*gompcreader.MinorPlanet, error) {
+	if source.closed {
+		return nil, io.EOF
+	}
+	result, ok := <-source.records
+	if !ok {
+		source.closed = true
+		return nil, io.EOF
+	}
+	source.count = source.count + 1
+	return result, nil
+}
+
+/*
+Close stops reading from the channel. The sender is responsible for closing the channel itself.
+*/
+func (source *ChannelSource) Close() error {
+	source.closed = true
+	return nil
+}
+
+/*
+Source describes the channel.
+*/
+func (source *ChannelSource) Source() SourceInfo {
+	return SourceInfo{source.name, "channel", source.count}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wselwood/gompcreader"
+)
+
+func TestSliceSource(t *testing.T) {
+	source := NewSliceSource("test", []*gompcreader.MinorPlanet{planet("a", 2010, 1), planet("b", 2010, 1)})
+
+	result := readAll(t, source)
+	assert.Len(t, result, 2)
+	assert.Equal(t, SourceInfo{"test", "memory", 2}, source.Source())
+}
+
+func TestChannelSource(t *testing.T) {
+	records := make(chan *gompcreader.MinorPlanet)
+	go func() {
+		records <- planet("a", 2010, 1)
+		records <- planet("b", 2010, 1)
+		close(records)
+	}()
+	source := NewChannelSource("test", records)
+
+	result := readAll(t, source)
+	assert.Len(t, result, 2)
+	assert.Equal(t, "b", result[1].ID)
+
+	_, err := source.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestProcessRecords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astro-grid")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ceres, err := parseMpcorbLine(ceresLine)
+	assert.NoError(t, err)
+
+	dimensions := BuildDimensions(DefaultAlbedo())
+	run, err := ProcessRecords(NewSliceSource("test", []*gompcreader.MinorPlanet{ceres}), dimensions[:], dir)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), run.Records)
+
+	// semi-major axis against eccentricity
+	cell := run.Grids[6][4].G[27][7]
+	assert.Equal(t, int32(1), cell.Count)
+	assert.Equal(t, "2.7", cell.StartX)
+	assert.Equal(t, "0.07", cell.StartY)
+
+	drilldown, err := ioutil.ReadFile(filepath.Join(dir, "Semi-Major-Axis", "Orbital-Eccentricity", "27", "7.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "id\n00001", string(drilldown))
+}
+
+func TestProcessRecordsMultiValued(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astro-grid")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pha, err := parseMpcorbLine(ceresLine)
+	assert.NoError(t, err)
+	pha.ID = "99942"
+	pha.HexFlags = "9803"
+
+	dimensions := []Dimension{buildFlags(), buildOrbitalEccentricity()}
+	run, err := ProcessRecords(NewSliceSource("test", []*gompcreader.MinorPlanet{pha}), dimensions, dir)
+	assert.NoError(t, err)
+
+	// counted as a NEO, a 1 km NEO and as a PHA
+	assert.Equal(t, int32(1), run.Grids[0][1].G[0][7].Count)
+	assert.Equal(t, "neo", run.Grids[0][1].G[0][7].StartX)
+	assert.Equal(t, int32(1), run.Grids[0][1].G[1][7].Count)
+	assert.Equal(t, "1km-neo", run.Grids[0][1].G[1][7].StartX)
+	assert.Equal(t, int32(1), run.Grids[0][1].G[4][7].Count)
+	assert.Equal(t, "pha", run.Grids[0][1].G[4][7].StartX)
+	assert.Equal(t, int32(1), run.Grids[0][0].G[0][4].Count)
+	assert.Equal(t, int32(1), run.Grids[0][0].G[1][4].Count)
+	assert.Equal(t, int32(0), run.Grids[0][0].G[2][2].Count)
+}
+
+func TestProcessRecordsAngles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astro-grid")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ceres, err := parseMpcorbLine(ceresLine)
+	assert.NoError(t, err)
+	ceres.ArgumentOfPerihelion = 2.5
+
+	dimensions := []Dimension{buildArgumentOfPerihelion(), buildOrbitalEccentricity()}
+	run, err := ProcessRecords(NewSliceSource("test", []*gompcreader.MinorPlanet{ceres}), dimensions, dir)
+	assert.NoError(t, err)
+
+	// the 0-5 degree cell is counted
+	assert.Equal(t, int32(1), run.Grids[0][1].G[0][7].Count)
+	assert.Equal(t, "0.0", run.Grids[0][1].G[0][7].StartX)
+	assert.Equal(t, int32(1), run.Grids[0][0].G[0][0].Count)
+}
+
+func TestProcessRecordsCategories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astro-grid")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ceres, err := parseMpcorbLine(ceresLine)
+	assert.NoError(t, err)
+	single, err := parseMpcorbLine(singleOppositionLine)
+	assert.NoError(t, err)
+
+	dimensions := []Dimension{buildUncertainty(), buildOrbitalEccentricity()}
+	run, err := ProcessRecords(NewSliceSource("test", []*gompcreader.MinorPlanet{ceres, single}), dimensions, dir)
+	assert.NoError(t, err)
+
+	// U 0 is the first category
+	assert.Equal(t, int32(1), run.Grids[0][1].G[0][7].Count)
+	assert.Equal(t, "0", run.Grids[0][1].G[0][7].StartX)
+	assert.Equal(t, int32(1), run.Grids[0][1].G[10][7].Count)
+	assert.Equal(t, "E", run.Grids[0][1].G[10][7].StartX)
+	assert.Equal(t, Exclusions{2, 0, 0, 0}, run.Excluded[0])
+}
+
+func TestProcessRecordsExclusions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astro-grid")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var records []*gompcreader.MinorPlanet
+	for _, year := range []int64{1990, 1915, 0, 1900, 2020} {
+		record := planet("x", 2020, 1)
+		record.OrbitalEccentricity = 0.005
+		record.InclinationToTheEcliptic = 0.5
+		record.YearOfFirstObservation = year
+		records = append(records, record)
+	}
+	records[1].InclinationToTheEcliptic = 95
+
+	dimensions := []Dimension{buildOrbitalEccentricity(), buildInclinationToTheEcliptic(), buildYearOfFirstObs()}
+	run, err := ProcessRecords(NewSliceSource("test", records), dimensions, dir)
+	assert.NoError(t, err)
+
+	// the lowest cell is counted
+	assert.Equal(t, int32(4), run.Grids[0][1].G[0][0].Count)
+	assert.Equal(t, Exclusions{5, 0, 0, 0}, run.Excluded[0])
+	assert.Equal(t, Exclusions{5, 0, 1, 0}, run.Excluded[1])
+	assert.Equal(t, Exclusions{5, 1, 1, 1}, run.Excluded[2])
+
+	// the excluded records are in the grids after the normal cells
+	overflow := run.Grids[1][2].G[91][0]
+	assert.Equal(t, int32(1), overflow.Count)
+	assert.Equal(t, "overflow", overflow.StartX)
+	assert.Equal(t, "1915", overflow.StartY)
+	assert.Equal(t, int32(1), run.Grids[0][2].G[0][101].Count, "underflow")
+	assert.Equal(t, int32(1), run.Grids[0][2].G[0][102].Count, "overflow")
+	assert.Equal(t, "missing", run.Grids[0][2].G[0][103].StartY)
+	drilldown, err := ioutil.ReadFile(filepath.Join(dir, "Inclination-To-The-Ecliptic", "Year-Of-First-Obs", "91", "0.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "id\nx\n", string(drilldown))
+
+	// every record is in one cell of each dimension
+	for i := range dimensions {
+		var total int64
+		for _, column := range run.Grids[i][i].G {
+			for _, cell := range column {
+				total = total + int64(cell.Count)
+			}
+		}
+		assert.Equal(t, run.Records, total, dimensions[i].Name)
+	}
+
+	rendered := withExclusions(dimensions, run.Excluded)
+	assert.Equal(t, []Bucket{{90, "underflow"}, {91, "overflow"}, {92, "missing"}}, rendered[1].Buckets)
+	assert.Empty(t, dimensions[1].Buckets)
+}